@@ -24,7 +24,7 @@ switch (process.platform) {
 const binPath = path.join(__dirname, binName);
 
 // Spawn the executable
-const child = spawn(binPath, [], { stdio: "inherit" });
+const child = spawn(binPath, process.argv.slice(2), { stdio: "inherit" });
 
 child.on("error", (err) => {
     console.error(`Failed to start process: ${err.message}`);
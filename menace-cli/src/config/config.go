@@ -0,0 +1,306 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the config file in the user config dir and in a project's .menace dir
+const FileName = "config.json"
+
+// Config is the merged user and project configuration.
+//
+// Project values override user values; maps are merged key by key.
+type Config struct {
+	// Persona used at startup, "" for the default
+	DefaultPersona string             `json:"default_persona,omitempty"`
+	Personas       map[string]Persona `json:"personas,omitempty"`
+	// EditorMode is "vim" for Vim keybindings in the input, "" or "default" for the default editor
+	EditorMode string `json:"editor_mode,omitempty"`
+	// Keys rebinds actions, action ID to keys such as "ctrl+s". An empty list unbinds the action.
+	Keys map[string][]string `json:"keys,omitempty"`
+	// Theme is "auto" (follow the terminal background), a built-in theme or one from Themes
+	Theme  string           `json:"theme,omitempty"`
+	Themes map[string]Theme `json:"themes,omitempty"`
+	// Provider and Model are the model used at startup
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// APIKeys by provider ("openai", "anthropic"), used when the provider's environment variable isn't set
+	APIKeys map[string]string `json:"api_keys,omitempty"`
+	// ApprovalPolicy is "always" or "never" to override the agent's choice of what needs approval
+	ApprovalPolicy string     `json:"approval_policy,omitempty"`
+	Generation     Generation `json:"generation,omitempty"`
+	// Sidebar hides the sidebar when false
+	Sidebar *bool `json:"sidebar,omitempty"`
+	// Shell runs approved commands, e.g. "bash" or "pwsh". Empty uses sh, or cmd on Windows,
+	// DefaultShell does too but overrides the user config's shell from the project config.
+	Shell string `json:"shell,omitempty"`
+	// Ollama is where the Ollama server runs and how its models are loaded
+	Ollama Ollama `json:"ollama,omitempty"`
+}
+
+// DefaultShell is the Shell value that selects the default shell
+const DefaultShell = "default"
+
+// Ollama configures the local Ollama server
+type Ollama struct {
+	// Host is the server address, e.g. "http://localhost:11434", used when OLLAMA_HOST isn't set
+	Host string `json:"host,omitempty"`
+	// Models holds runtime options by model tag, e.g. "llama3:8b"
+	Models map[string]OllamaOptions `json:"models,omitempty"`
+}
+
+// OllamaOptions are the runtime options of an Ollama model, zero values use the server's defaults
+type OllamaOptions struct {
+	// NumCtx is the context window in tokens
+	NumCtx int `json:"num_ctx,omitempty"`
+	// KeepAlive is how long the model stays loaded after a request, e.g. "10m", or "-1m" for ever
+	KeepAlive string `json:"keep_alive,omitempty"`
+}
+
+// Generation holds the sampling options sent with every request, nil uses the defaults
+type Generation struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	// MaxTokens of 0 uses the provider's default, unlike nil it overrides the user config
+	MaxTokens *int `json:"max_tokens,omitempty"`
+}
+
+// Persona is a named prompt template with optional model and tool restrictions.
+//
+// Prompt and SystemPrompt may use the placeholders {{shell}}, {{cwd}} and {{os}}.
+type Persona struct {
+	Description string `json:"description,omitempty"`
+	// Prompt is appended to the built-in system prompt
+	Prompt string `json:"prompt,omitempty"`
+	// SystemPrompt replaces the built-in system prompt entirely
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Provider and Model switch the model when the persona is selected
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Tools limits which functions the model may call, "shell" allows command suggestions. Empty allows all.
+	Tools []string `json:"tools,omitempty"`
+}
+
+// Theme is a set of UI colors, each an ANSI color number ("12") or a hex color ("#bd93f9").
+//
+// Colors left empty are taken from Base.
+type Theme struct {
+	// Base is the theme this one extends, "auto" by default
+	Base string `json:"base,omitempty"`
+	// Text is the sidebar and button text
+	Text string `json:"text,omitempty"`
+	// Heading is used for titles and questions
+	Heading string `json:"heading,omitempty"`
+	Border  string `json:"border,omitempty"`
+	Input   string `json:"input,omitempty"`
+	User    string `json:"user,omitempty"`
+	Agent   string `json:"agent,omitempty"`
+	System  string `json:"system,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Muted is used for hints, code block headers and the command popup
+	Muted string `json:"muted,omitempty"`
+	// Accent is used for buttons, section titles and attachment chips
+	Accent string `json:"accent,omitempty"`
+	// AccentText is text drawn on Accent, Selected or Highlight backgrounds
+	AccentText string `json:"accent_text,omitempty"`
+	// Selected marks the current menu entry and the input selection
+	Selected string `json:"selected,omitempty"`
+	// Highlight is used for search matches and the Vim mode indicator
+	Highlight       string `json:"highlight,omitempty"`
+	MatchBackground string `json:"match_background,omitempty"`
+	// Markdown is the style of rendered responses, "dark" or "light"
+	Markdown string `json:"markdown,omitempty"`
+}
+
+// UserFile is the path of the user config file
+func UserFile() string {
+	return filepath.Join(UserDir(), FileName)
+}
+
+// ProjectFile is the path of the project config file
+func ProjectFile() string {
+	return filepath.Join(ProjectDir(), FileName)
+}
+
+// Load reads the user config and then the project config on top of it.
+//
+// Missing files are fine, malformed ones are an error naming the file.
+func Load() (*Config, error) {
+	cfg := &Config{Personas: map[string]Persona{}, Keys: map[string][]string{}, Themes: map[string]Theme{}, APIKeys: map[string]string{}}
+	cfg.Ollama.Models = map[string]OllamaOptions{}
+	for _, path := range []string{UserFile(), ProjectFile()} {
+		if err := cfg.merge(path); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// merge applies the config file at path on top of cfg
+func (cfg *Config) merge(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+
+	var file Config
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	if file.DefaultPersona != "" {
+		cfg.DefaultPersona = file.DefaultPersona
+	}
+	if file.EditorMode != "" {
+		cfg.EditorMode = file.EditorMode
+	}
+	if file.Theme != "" {
+		cfg.Theme = file.Theme
+	}
+	if file.Model != "" {
+		cfg.Provider = file.Provider
+		cfg.Model = file.Model
+	}
+	if file.ApprovalPolicy != "" {
+		cfg.ApprovalPolicy = file.ApprovalPolicy
+	}
+	if file.Generation.Temperature != nil {
+		cfg.Generation.Temperature = file.Generation.Temperature
+	}
+	if file.Generation.MaxTokens != nil {
+		cfg.Generation.MaxTokens = file.Generation.MaxTokens
+	}
+	if file.Sidebar != nil {
+		cfg.Sidebar = file.Sidebar
+	}
+	if file.Shell == DefaultShell {
+		cfg.Shell = ""
+	} else if file.Shell != "" {
+		cfg.Shell = file.Shell
+	}
+	if file.Ollama.Host != "" {
+		cfg.Ollama.Host = file.Ollama.Host
+	}
+	for name, options := range file.Ollama.Models {
+		cfg.Ollama.Models[name] = options
+	}
+	for provider, key := range file.APIKeys {
+		cfg.APIKeys[provider] = key
+	}
+	for name, persona := range file.Personas {
+		cfg.Personas[name] = persona
+	}
+	for action, keys := range file.Keys {
+		cfg.Keys[action] = keys
+	}
+	for name, theme := range file.Themes {
+		cfg.Themes[name] = theme
+	}
+	return nil
+}
+
+// Set writes one value to the config file at path, keeping everything else in it.
+//
+// key may name a nested value, e.g. "generation.temperature". A nil value removes the key.
+// The file and its directory are created if needed.
+func Set(path string, key string, value interface{}) error {
+	return SetPath(path, strings.Split(key, "."), value)
+}
+
+// SetPath is Set with the key already split, for keys containing dots such as Ollama model tags
+func SetPath(path string, parts []string, value interface{}) error {
+	file := map[string]interface{}{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse config %s: %v", path, err)
+		}
+	}
+
+	section := file
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := section[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			section[part] = next
+		}
+		section = next
+	}
+	if value == nil {
+		delete(section, parts[len(parts)-1])
+	} else {
+		section[parts[len(parts)-1]] = value
+	}
+	// Drop sections emptied by the removal
+	for i := len(parts) - 2; i >= 0 && value == nil; i-- {
+		parent := file
+		for _, part := range parts[:i] {
+			parent = parent[part].(map[string]interface{})
+		}
+		if len(parent[parts[i]].(map[string]interface{})) > 0 {
+			break
+		}
+		delete(parent, parts[i])
+	}
+
+	data, err = json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode config %s: %v", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	// The file may hold API keys, so it is replaced by a 0600 temp file rather than
+	// written in place, which would keep the mode of a file created without Set
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write config %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config %s: %v", path, err)
+	}
+	return nil
+}
+
+// IsSet reports whether the config file at path has a value for key, see Set
+func IsSet(path string, key string) bool {
+	return IsSetPath(path, strings.Split(key, "."))
+}
+
+// IsSetPath is IsSet with the key already split, see SetPath
+func IsSetPath(path string, parts []string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var value interface{} = map[string]interface{}{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return false
+	}
+	for _, part := range parts {
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = section[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AppName is the directory name used under the user config dir and in projects
+const AppName = "menace"
+
+// ProjectDirName is the per-project config directory, e.g. ".menace/commands"
+const ProjectDirName = ".menace"
+
+// UserDir returns the user config directory, e.g. ~/.config/menace on Linux.
+//
+// Falls back to ~/.menace if the OS has no config dir.
+func UserDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ProjectDirName
+		}
+		return filepath.Join(home, ProjectDirName)
+	}
+	return filepath.Join(dir, AppName)
+}
+
+// ProjectDir returns the .menace directory of the current project
+func ProjectDir() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ProjectDirName
+	}
+	return filepath.Join(cwd, ProjectDirName)
+}
@@ -3,27 +3,45 @@ package llmServer
 import (
 	"context"
 	"fmt"
+	"menace-go/config"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/anthropic"
-	"github.com/tmc/langchaingo/llms/openai"
 	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
 )
 
 // Agent represents the main agent that processes LLM responses and executes commands.
 //
 // Does not include System messages
 type Agent struct {
-	llm      llms.Model
-	mu       sync.Mutex
-	shell    string // typically in the form "windows/CMD", "linux/bash", "darwin/bash" etc
-	messages []llms.MessageContent
-	ctx      context.Context
-	provider string
-	Model    string
-	isOpenSource bool
+	llm           llms.Model
+	mu            sync.Mutex
+	shell         string // typically in the form "windows/CMD", "linux/bash", "darwin/bash" etc
+	messages      []llms.MessageContent
+	turn          sync.Mutex // held for a whole SendMessage, so turns never interleave
+	epoch         int        // bumped whenever the conversation is replaced, see SendMessage
+	ctx           context.Context
+	provider      string
+	Model         string
+	isOpenSource  bool
+	pinned        []string // files re-read into the context on every turn
+	project       string   // project root, scopes memories
+	memory        *MemoryStore
+	memoryErr     error // why memory is unavailable, if it is
+	persona       string
+	personas      map[string]config.Persona
+	personaSwitch *personaModelSwitch // the model to restore when leaving a persona with its own model
+	usage         Usage
+	override      *TaskOverride // temporary model/tools, see SetOverride
+	generation    config.Generation
+	ollamaOptions map[string]config.OllamaOptions // runtime options by Ollama model tag
 }
 
 // NewAgent creates a new agent instance
@@ -41,60 +59,198 @@ func NewAgent(apiKey string) (*Agent, error) {
 
 	ctx := context.Background()
 
-	return &Agent{
+	agent := &Agent{
 		llm:      llm,
 		shell:    ModelFactory{}.DetectShell(),
 		Model:    "o4-mini-2025-04-16",
 		provider: "openai",
-		messages: []llms.MessageContent{
-			{
-				Role:  llms.ChatMessageTypeSystem,
-				Parts: []llms.ContentPart{llms.TextContent{Text: getSystemPrompt(ModelFactory{}.DetectShell())}},
-			},
-		},
-		ctx: ctx,
-	}, nil
+		ctx:      ctx,
+		project:  ProjectRoot(),
+		persona:  DefaultPersona,
+		personas: BuiltinPersonas,
+	}
+	// Memory is optional, a broken memory file shouldn't stop the CLI from starting
+	agent.memory, agent.memoryErr = OpenMemoryStore(DefaultMemoryPath())
+	agent.messages = []llms.MessageContent{systemMessage(agent.systemPrompt())}
+	return agent, nil
+}
+
+// systemPrompt builds the system prompt for the active persona, including project instructions
+// and remembered facts
+//
+// Caller must hold a.mu if the agent is in use.
+func (a *Agent) systemPrompt() string {
+	prompt := personaPrompt(a.personas[a.persona], a.shell)
+	if a.memory != nil {
+		prompt += memoriesPrompt(a.memory.Visible(a.project))
+	}
+	return prompt
+}
+
+// systemMessage wraps a system prompt as the first message of the history
+func systemMessage(prompt string) llms.MessageContent {
+	return llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: []llms.ContentPart{llms.TextContent{Text: prompt}},
+	}
+}
+
+// MaxToolCallRetries is how many times the model is asked to fix a malformed
+// [COMMAND_SUGGESTION]/[FUNCTION_CALL] block before SendMessage gives up.
+const MaxToolCallRetries = 2
+
+// Response is one parsed turn from the LLM.
+//
+// At most one of Command and Function is set.
+type Response struct {
+	Text     string
+	Command  *CommandSuggestion
+	Function *FunctionCall
+	// FailedAttempts holds the responses that were rejected and automatically retried
+	FailedAttempts []FailedAttempt
+}
+
+// FailedAttempt is a response the model had to redo because its block could not be used
+type FailedAttempt struct {
+	Text string
+	Err  error
 }
 
 // SendMessage sends a message to the LLM and returns the response
 //
 // Sends a message to the LLM, returns a response.
-// Parses the response, and returns a CommandSuggestion if found
+// Any images are attached to the user message; the current model must support vision.
+// Parses the response for a CommandSuggestion or FunctionCall.
+// If a block is malformed or names an unknown function, the model is told exactly what
+// went wrong and asked again, up to MaxToolCallRetries times. If it still fails, the
+// last response is returned together with a *ParseError.
 //
 // Does not interact with UI model.Messages at all.
-// Returns: response, commandSuggestion, error
-func (a *Agent) SendMessage(ctx context.Context, input string) (string, *CommandSuggestion, error) {
+// Returns: response, error
+func (a *Agent) SendMessage(ctx context.Context, input string, images ...ImageAttachment) (*Response, error) {
+	a.turn.Lock()
+	defer a.turn.Unlock()
+
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	// Re-read the system prompt so MENACE.md edits and new memories apply from the next message on
+	a.messages[0] = systemMessage(a.systemPrompt())
 
-	// Add user message to history
+	llm, provider, model := a.activeModel()
+	if len(images) > 0 && !SupportsVision(provider, model) {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("model %s does not support image input", model)
+	}
+
+	// Add user message to history, images go after the text
+	parts := []llms.ContentPart{llms.TextContent{Text: input}}
+	for _, image := range images {
+		parts = append(parts, imagePart(provider, image))
+	}
 	a.messages = append(a.messages, llms.MessageContent{
 		Role:  llms.ChatMessageTypeHuman,
-		Parts: []llms.ContentPart{llms.TextContent{Text: input}},
+		Parts: parts,
 	})
+	epoch := a.epoch
+	a.mu.Unlock()
 
-	// Get response from LLM
-	response, err := a.llm.GenerateContent(a.ctx, a.messages, llms.WithTemperature(1))
+	result := &Response{}
+	for attempt := 0; ; attempt++ {
+		// The lock isn't held during the request, the UI reads the agent on every frame
+		a.mu.Lock()
+		messages := append([]llms.MessageContent(nil), a.contextMessages()...)
+		options := a.callOptions()
+		a.mu.Unlock()
+
+		// Get response from LLM
+		response, err := llm.GenerateContent(a.ctx, messages, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get response from LLM: %v", err)
+		}
+
+		a.mu.Lock()
+		// The conversation was cleared, rewound or switched during the request
+		if a.epoch != epoch {
+			a.mu.Unlock()
+			return nil, fmt.Errorf("the conversation changed while waiting for the model, its reply was dropped")
+		}
+
+		// Extract the response text
+		var responseText string
+		if len(response.Choices) > 0 {
+			responseText = response.Choices[0].Content
+			a.recordUsage(provider, model, response.Choices[0].GenerationInfo)
+		}
+
+		// Add assistant's response to history
+		a.messages = append(a.messages, llms.MessageContent{
+			Role:  llms.ChatMessageTypeAI,
+			Parts: []llms.ContentPart{llms.TextContent{Text: responseText}},
+		})
+
+		result.Text = responseText
+		result.Command, result.Function, err = a.parseResponse(responseText)
+		if err == nil || attempt == MaxToolCallRetries {
+			a.mu.Unlock()
+			return result, err
+		}
+
+		// Feed the error back so the model can correct itself
+		result.FailedAttempts = append(result.FailedAttempts, FailedAttempt{Text: responseText, Err: err})
+		a.messages = append(a.messages, llms.MessageContent{
+			Role: llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{llms.TextContent{Text: fmt.Sprintf(
+				"Your last response could not be executed: %s. Resend the complete corrected block in the exact format from the instructions. Do not apologise or repeat the rest of your answer.",
+				err,
+			)}},
+		})
+		a.mu.Unlock()
+	}
+}
+
+// parseResponse pulls the command suggestion or function call out of an LLM response.
+//
+// Function names are checked against AvailableFunctions and both are checked against
+// the tool list of the active persona or override. Caller must hold a.mu.
+func (a *Agent) parseResponse(responseText string) (*CommandSuggestion, *FunctionCall, error) {
+	tools, source := a.allowedTools()
+	cmdSuggestion, err := parseCommandSuggestion(responseText)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to get response from LLM: %v", err)
+		return nil, nil, err
 	}
-	// Extract the response text
-	var responseText string
-	if len(response.Choices) > 0 {
-		responseText = response.Choices[0].Content
+	if cmdSuggestion != nil {
+		if !a.toolAllowed(ShellTool) {
+			return nil, nil, &ParseError{
+				Block:  "COMMAND_SUGGESTION",
+				Reason: fmt.Sprintf("shell commands are not allowed for %s, allowed tools are %s", source, strings.Join(tools, ", ")),
+			}
+		}
+		return cmdSuggestion, nil, nil
 	}
 
-	// Parse for command suggestion
-	//integrate this with code execution
-	cmdSuggestion := parseCommandSuggestion(responseText)
-	
-	// Add assistant's response to history
-	a.messages = append(a.messages, llms.MessageContent{
-		Role:  llms.ChatMessageTypeAI,
-		Parts: []llms.ContentPart{llms.TextContent{Text: responseText}},
-	})
-
-	return responseText, cmdSuggestion, nil
+	fnCall, err := ParseFunctionCall(responseText)
+	if err != nil || fnCall == nil {
+		return nil, nil, err
+	}
+	if !IsAvailableFunction(fnCall.Name) {
+		return nil, nil, &ParseError{
+			Block:  "FUNCTION_CALL",
+			Field:  "name",
+			Reason: fmt.Sprintf("unknown function %q, available functions are %s", fnCall.Name, strings.Join(AvailableFunctions, ", ")),
+		}
+	}
+	if !a.toolAllowed(fnCall.Name) {
+		return nil, nil, &ParseError{
+			Block:  "FUNCTION_CALL",
+			Field:  "name",
+			Reason: fmt.Sprintf("function %q is not allowed for %s, allowed tools are %s", fnCall.Name, source, strings.Join(tools, ", ")),
+		}
+	}
+	if fnCall.Name == AskUserFunction {
+		if _, err := ParseQuestion(fnCall); err != nil {
+			return nil, nil, err
+		}
+	}
+	return nil, fnCall, nil
 }
 
 // ClearHistory clears the conversation history
@@ -105,22 +261,97 @@ func (a *Agent) ClearHistory() {
 	defer a.mu.Unlock()
 
 	// Keep only the system message
-	a.messages = []llms.MessageContent{
-		{
-			Role:  llms.ChatMessageTypeSystem,
-			Parts: []llms.ContentPart{llms.TextContent{Text: getSystemPrompt(a.shell)}},
-		},
-	}
+	a.messages = []llms.MessageContent{systemMessage(a.systemPrompt())}
+	a.epoch++
+	a.override = nil
 }
 
 func (a *Agent) SetModel(provider string, model string, openSource bool) error {
+	llm, err := a.newLLM(provider, model)
+	if err != nil {
+		return err
+	}
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	a.provider = provider
 	a.Model = model
 	a.isOpenSource = openSource
+	a.llm = llm
+	return nil
+}
+
+// ReloadModel creates a new client for the current model, picking up changed API keys
+func (a *Agent) ReloadModel() error {
+	a.mu.Lock()
+	provider, model, openSource := a.provider, a.Model, a.isOpenSource
+	a.mu.Unlock()
+	return a.SetModel(provider, model, openSource)
+}
+
+// Provider returns the provider of the agent's own model
+func (a *Agent) Provider() string {
+	return a.currentProvider()
+}
+
+// SetGeneration sets the sampling options for the following requests
+func (a *Agent) SetGeneration(generation config.Generation) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.generation = generation
+}
+
+// callOptions turns the generation options into request options, caller must hold a.mu.
+//
+// The temperature defaults to 1, the only value OpenAI's reasoning models accept.
+func (a *Agent) callOptions() []llms.CallOption {
+	temperature := 1.0
+	if a.generation.Temperature != nil {
+		temperature = *a.generation.Temperature
+	}
+	options := []llms.CallOption{llms.WithTemperature(temperature)}
+	if a.generation.MaxTokens != nil && *a.generation.MaxTokens > 0 {
+		options = append(options, llms.WithMaxTokens(*a.generation.MaxTokens))
+	}
+	return options
+}
+
+// SetShell tells the agent which shell runs its commands, "" for the login shell.
+//
+// The system prompt is rebuilt before the next request.
+func (a *Agent) SetShell(shell string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if shell == "" {
+		a.shell = ModelFactory{}.DetectShell()
+		return
+	}
+	a.shell = runtime.GOOS + "/" + strings.TrimSuffix(filepath.Base(shell), ".exe")
+}
+
+// Shell returns the shell commands run in, e.g. "linux/bash"
+func (a *Agent) Shell() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.shell
+}
+
+// SetOllamaOptions sets the runtime options of Ollama models, used by clients created from now on
+func (a *Agent) SetOllamaOptions(options map[string]config.OllamaOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ollamaOptions = options
+}
+
+// APIKeyEnv names the environment variable holding each provider's API key
+var APIKeyEnv = map[string]string{
+	"openai":    "OPENAI_API_KEY",
+	"anthropic": "ANTHROPIC_API_KEY",
+}
 
+// newLLM creates a client for model on provider
+func (a *Agent) newLLM(provider string, model string) (llms.Model, error) {
 	switch provider {
 	case "anthropic":
 		llm, err := anthropic.New(
@@ -128,31 +359,43 @@ func (a *Agent) SetModel(provider string, model string, openSource bool) error {
 			anthropic.WithModel(model),
 		)
 		if err != nil {
-			return fmt.Errorf("failed to create Anthropic client with model %s: %v", model, err)
+			return nil, fmt.Errorf("failed to create Anthropic client with model %s: %v", model, err)
 		}
-		a.llm = llm
-		return nil
+		return llm, nil
 	case "openai":
 		llm, err := openai.New(
 			openai.WithToken(os.Getenv("OPENAI_API_KEY")),
 			openai.WithModel(model),
 		)
 		if err != nil {
-			return fmt.Errorf("failed to create OpenAI client with model %s: %v", model, err)
+			return nil, fmt.Errorf("failed to create OpenAI client with model %s: %v", model, err)
 		}
-		a.llm = llm
-		return nil
+		return llm, nil
 	case "ollama":
-		llm, err := ollama.New(
+		a.mu.Lock()
+		modelOptions := a.ollamaOptions[model]
+		a.mu.Unlock()
+		// WithServerURL exits on a malformed URL
+		if _, err := url.Parse(OllamaHost()); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", OllamaHostEnv, err)
+		}
+		options := []ollama.Option{
 			ollama.WithModel(model),
-		)
+			ollama.WithServerURL(OllamaHost()),
+		}
+		if modelOptions.NumCtx > 0 {
+			options = append(options, ollama.WithRunnerNumCtx(modelOptions.NumCtx))
+		}
+		if modelOptions.KeepAlive != "" {
+			options = append(options, ollama.WithKeepAlive(modelOptions.KeepAlive))
+		}
+		llm, err := ollama.New(options...)
 		if err != nil {
-			return fmt.Errorf("failed to create Ollama client with model %s: %v", model, err)
+			return nil, fmt.Errorf("failed to create Ollama client with model %s: %v", model, err)
 		}
-		a.llm = llm
-		return nil
+		return llm, nil
 	default:
-		return fmt.Errorf("unknown provider: %s", provider)
+		return nil, fmt.Errorf("unknown provider: %s", provider)
 	}
 }
 
@@ -160,6 +403,8 @@ func (a *Agent) AddToMessageChain(new_message string, role llms.ChatMessageType)
 	if role == "" {
 		role = llms.ChatMessageTypeSystem
 	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.messages = append(a.messages, llms.MessageContent{
 		Role:  role,
 		Parts: []llms.ContentPart{llms.TextContent{Text: new_message}},
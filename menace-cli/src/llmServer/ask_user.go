@@ -0,0 +1,44 @@
+package llmServer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AskUserFunction is the function the model calls to ask the user a multiple-choice question
+const AskUserFunction = "askUser"
+
+// MaxQuestionOptions is the most options a question may offer, besides free text
+const MaxQuestionOptions = 9
+
+// Question is a parsed askUser call
+type Question struct {
+	Text    string
+	Options []string
+}
+
+// ParseQuestion reads the question and options from an askUser function call
+func ParseQuestion(fnCall *FunctionCall) (*Question, error) {
+	text, _ := fnCall.Args["question"].(string)
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, &ParseError{Block: "FUNCTION_CALL", Field: "args.question", Reason: "askUser needs a non-empty question"}
+	}
+
+	raw, ok := fnCall.Args["options"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, &ParseError{Block: "FUNCTION_CALL", Field: "args.options", Reason: "askUser needs a non-empty array of option strings"}
+	}
+	if len(raw) > MaxQuestionOptions {
+		return nil, &ParseError{Block: "FUNCTION_CALL", Field: "args.options", Reason: fmt.Sprintf("askUser takes at most %d options", MaxQuestionOptions)}
+	}
+	question := &Question{Text: text}
+	for i, option := range raw {
+		s, ok := option.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			return nil, &ParseError{Block: "FUNCTION_CALL", Field: fmt.Sprintf("args.options[%d]", i), Reason: "options must be non-empty strings"}
+		}
+		question.Options = append(question.Options, strings.TrimSpace(s))
+	}
+	return question, nil
+}
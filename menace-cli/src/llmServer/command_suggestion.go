@@ -8,45 +8,40 @@ type CommandSuggestion struct {
 	Reason string
 	Command string
 	AwaitingCommandApproval bool
+	// Narrative is the model's prose outside of the [COMMAND_SUGGESTION] block
+	Narrative string
 }
 
 // Run this after every LLM response
 //
 // Returns a CommandSuggestion if a command is found.
-// Returns nil otherwise.
-func parseCommandSuggestion(response string) *CommandSuggestion {
-	// Find the command suggestion block
-	start := strings.Index(response, "[COMMAND_SUGGESTION]")
-	end := strings.Index(response, "[/COMMAND_SUGGESTION]")
-
-	if start == -1 || end == -1 {
-		return nil
+// Returns nil, nil if the response has no [COMMAND_SUGGESTION] block,
+// and a *ParseError if the block is there but unusable.
+func parseCommandSuggestion(response string) (*CommandSuggestion, error) {
+	const tag = "COMMAND_SUGGESTION"
+	block, found, err := findBlock(response, tag, []string{"Reason", "Command", "AwaitingCommandApproval"})
+	if !found || err != nil {
+		return nil, err
 	}
 
-	// Extract the content between the tags
-	content := response[start:end]
-
-	// Parse reason and command
-	reasonStart := strings.Index(content, "Reason: ")
-	commandStart := strings.Index(content, "Command: ")
-	awaitCmdApproval := strings.Index(content, "AwaitingCommandApproval: ")
-
-	if reasonStart == -1 || commandStart == -1 || awaitCmdApproval == -1 {
-		return nil
+	command := stripCodeFence(block.Fields["command"])
+	if command == "" {
+		return nil, &ParseError{Block: tag, Field: "Command", Reason: "missing or empty"}
 	}
 
-	// Extract reason (from "Reason: " to "Command: ")
-	reason := strings.TrimSpace(content[reasonStart+8 : commandStart])
-
-	// Extract command (from "Command: " to end)
-	command := strings.TrimSpace(content[commandStart+8 : awaitCmdApproval])
-
-	// Extract human needed (from "Human_needed: " to end)
-	cmdApproval := strings.TrimSpace(content[awaitCmdApproval+24:])
+	// Default to asking the human when the model forgot to say
+	cmdApproval := true
+	if raw, ok := block.Fields["awaitingcommandapproval"]; ok {
+		cmdApproval, err = parseBool(tag, "AwaitingCommandApproval", raw)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &CommandSuggestion{
-		Reason:  reason,
+		Reason:  strings.TrimSpace(block.Fields["reason"]),
 		Command: command,
-		AwaitingCommandApproval: cmdApproval == "true",
-	}
-}
\ No newline at end of file
+		AwaitingCommandApproval: cmdApproval,
+		Narrative: block.Narrative,
+	}, nil
+}
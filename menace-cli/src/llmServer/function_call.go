@@ -0,0 +1,107 @@
+package llmServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AvailableFunctions are the function names the UI knows how to execute
+var AvailableFunctions = []string{
+	"ReadFileWithLineNumbers",
+	"CreateAndApplyDiffs",
+	"createPullRequest",
+	"remember",
+	"recall",
+	"forget",
+	AskUserFunction,
+}
+
+// IsAvailableFunction reports whether name is one of AvailableFunctions
+func IsAvailableFunction(name string) bool {
+	for _, fn := range AvailableFunctions {
+		if fn == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FunctionCall is a parsed [FUNCTION_CALL] block
+type FunctionCall struct {
+	Name                    string
+	Reason                  string
+	AwaitingCommandApproval bool
+	Args                    map[string]interface{}
+	// Narrative is the model's prose outside of the [FUNCTION_CALL] block
+	Narrative string
+}
+
+// ParseFunctionCall parses a [FUNCTION_CALL] block from an LLM response.
+//
+// Returns nil, nil if the response has no [FUNCTION_CALL] block,
+// and a *ParseError if the block is there but unusable.
+func ParseFunctionCall(response string) (*FunctionCall, error) {
+	const tag = "FUNCTION_CALL"
+	block, found, err := findBlock(response, tag, []string{"Reason", "AwaitingCommandApproval", "Payload"})
+	if !found || err != nil {
+		return nil, err
+	}
+
+	payload := stripCodeFence(block.Fields["payload"])
+	if payload == "" {
+		return nil, &ParseError{Block: tag, Field: "Payload", Reason: "missing or empty"}
+	}
+	// Find the JSON object in the payload
+	jsonStart := strings.Index(payload, "{")
+	jsonEnd := strings.LastIndex(payload, "}")
+	if jsonStart == -1 || jsonEnd == -1 || jsonEnd <= jsonStart {
+		return nil, &ParseError{Block: tag, Field: "Payload", Reason: "no JSON object found"}
+	}
+	jsonStr := payload[jsonStart : jsonEnd+1]
+
+	var parsed struct {
+		Name string                 `json:"name"`
+		Args map[string]interface{} `json:"args"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &parsed); err != nil {
+		return nil, &ParseError{Block: tag, Field: "Payload", Reason: describeJSONError(jsonStr, err)}
+	}
+	if parsed.Name == "" {
+		return nil, &ParseError{Block: tag, Field: "Payload", Reason: `JSON object has no "name"`}
+	}
+
+	cmdApproval := true
+	if raw, ok := block.Fields["awaitingcommandapproval"]; ok {
+		cmdApproval, err = parseBool(tag, "AwaitingCommandApproval", raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &FunctionCall{
+		Name:                    parsed.Name,
+		Reason:                  strings.TrimSpace(block.Fields["reason"]),
+		AwaitingCommandApproval: cmdApproval,
+		Args:                    parsed.Args,
+		Narrative:               block.Narrative,
+	}, nil
+}
+
+// describeJSONError turns a json error into something the model can act on,
+// pointing at the line and column where decoding failed.
+func describeJSONError(jsonStr string, err error) string {
+	syntaxErr, ok := err.(*json.SyntaxError)
+	if !ok {
+		return "invalid JSON: " + err.Error()
+	}
+	offset := int(syntaxErr.Offset)
+	if offset > len(jsonStr) {
+		offset = len(jsonStr)
+	}
+	line := strings.Count(jsonStr[:offset], "\n") + 1
+	col := offset - strings.LastIndex(jsonStr[:offset], "\n")
+	lines := strings.Split(jsonStr, "\n")
+	return fmt.Sprintf("invalid JSON at line %d, column %d: %s (near %q)",
+		line, col, syntaxErr.Error(), strings.TrimSpace(lines[line-1]))
+}
@@ -0,0 +1,55 @@
+package llmServer
+
+import (
+	"fmt"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// History is a snapshot of the conversation sent to the model, kept by the UI for branches
+type History []llms.MessageContent
+
+// HistoryLen returns the number of messages in the conversation, which is the index the next message gets
+func (a *Agent) HistoryLen() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.messages)
+}
+
+// History returns a copy of the conversation
+func (a *Agent) History() History {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append(History{}, a.messages...)
+}
+
+// Rewind cuts the conversation back to its first n messages.
+//
+// Returns the whole conversation as it was before the cut so it can be restored later.
+// The system message can't be removed.
+func (a *Agent) Rewind(n int) (History, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n < 1 || n > len(a.messages) {
+		return nil, fmt.Errorf("can't rewind to message %d of %d", n, len(a.messages))
+	}
+	before := append(History{}, a.messages...)
+	a.messages = a.messages[:n:n]
+	a.epoch++
+	return before, nil
+}
+
+// RestoreHistory replaces the conversation with a snapshot taken by Rewind.
+//
+// The system message is rebuilt, so persona or memory changes since the snapshot still apply.
+func (a *Agent) RestoreHistory(history History) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.messages = append([]llms.MessageContent{}, history...)
+	a.epoch++
+	if len(a.messages) == 0 {
+		a.messages = []llms.MessageContent{systemMessage(a.systemPrompt())}
+		return
+	}
+	a.messages[0] = systemMessage(a.systemPrompt())
+}
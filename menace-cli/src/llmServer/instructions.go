@@ -0,0 +1,69 @@
+package llmServer
+
+import (
+	"menace-go/config"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstructionsFileName is the project instructions file merged into the system prompt
+const InstructionsFileName = "MENACE.md"
+
+// InstructionFile is one MENACE.md found on disk
+type InstructionFile struct {
+	Path    string
+	Content string
+}
+
+// FindInstructionFiles returns every MENACE.md that applies to the working directory.
+//
+// Order is least to most specific: the user config dir first, then each directory from the
+// filesystem root down to the working directory. Later files take precedence.
+func FindInstructionFiles() []InstructionFile {
+	candidates := []string{filepath.Join(config.UserDir(), InstructionsFileName)}
+
+	if cwd, err := os.Getwd(); err == nil {
+		var dirs []string
+		for dir := cwd; ; dir = filepath.Dir(dir) {
+			dirs = append(dirs, dir)
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			candidates = append(candidates, filepath.Join(dirs[i], InstructionsFileName))
+		}
+	}
+
+	var files []InstructionFile
+	seen := map[string]bool{}
+	for _, path := range candidates {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if content := strings.TrimSpace(string(data)); content != "" {
+			files = append(files, InstructionFile{Path: path, Content: content})
+		}
+	}
+	return files
+}
+
+// instructionsPrompt renders the instruction files as a system prompt section, "" if there are none
+func instructionsPrompt(files []InstructionFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\nProject instructions from " + InstructionsFileName + " files. Follow them. ")
+	sb.WriteString("They are listed from most general to most specific; when they conflict, the later one wins.")
+	for _, file := range files {
+		sb.WriteString("\n\n### " + file.Path + "\n" + file.Content)
+	}
+	return sb.String()
+}
@@ -0,0 +1,339 @@
+package llmServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"menace-go/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory scopes
+const (
+	MemoryScopeUser    = "user"    // applies in every project
+	MemoryScopeProject = "project" // applies only to the project it was saved in
+)
+
+// MaxPromptMemories caps how many memories are put in the system prompt, the newest are kept
+const MaxPromptMemories = 30
+
+// memoryLockTimeout is how long to wait for another session to finish writing the memory file.
+// A lock file older than this was left behind by a crashed session and is taken over.
+const memoryLockTimeout = 5 * time.Second
+
+// Memory is one fact the agent chose to remember
+type Memory struct {
+	ID      string    `json:"id"`
+	Scope   string    `json:"scope"`
+	Project string    `json:"project,omitempty"` // project root, only for project scope
+	Content string    `json:"content"`
+	Created time.Time `json:"created"`
+}
+
+// MemoryStore is the agent's long-term memory, a JSON file in the user config dir.
+//
+// Several sessions can share the file: every change re-reads it under a lock file first,
+// so one session's memories never overwrite another's.
+type MemoryStore struct {
+	path     string
+	mu       sync.Mutex
+	memories []Memory
+	nextID   int
+}
+
+// DefaultMemoryPath is where memories are kept, one file per user
+func DefaultMemoryPath() string {
+	return filepath.Join(config.UserDir(), "memory.json")
+}
+
+// OpenMemoryStore loads the memory file at path, a missing file is an empty store
+func OpenMemoryStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load re-reads the memory file, picking up changes from other sessions.
+// On error the store is left as it was. Caller must hold s.mu.
+func (s *MemoryStore) load() error {
+	var memories []Memory
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read memory file %s: %v", s.path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &memories); err != nil {
+			return fmt.Errorf("failed to parse memory file %s: %v", s.path, err)
+		}
+	}
+	s.memories = memories
+	s.nextID = 1
+	for _, memory := range s.memories {
+		var n int
+		if _, err := fmt.Sscanf(memory.ID, "m%d", &n); err == nil && n >= s.nextID {
+			s.nextID = n + 1
+		}
+	}
+	return nil
+}
+
+// lockFile takes the lock file next to the memory file, returning the function that releases it
+func (s *MemoryStore) lockFile() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	lockPath := s.path + ".lock"
+	deadline := time.Now().Add(memoryLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock memory file: %v", err)
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > memoryLockTimeout {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("memory file is locked by another session, remove %s if none is running", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// update applies change to the latest memory file and writes it back, caller must hold s.mu
+func (s *MemoryStore) update(change func()) error {
+	unlock, err := s.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	change()
+
+	data, err := json.MarshalIndent(s.memories, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write a temp file and rename it, so readers never see a half-written file
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Remember stores a new memory. project is ignored for user scope.
+func (s *MemoryStore) Remember(scope string, project string, content string) (Memory, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return Memory{}, fmt.Errorf("memory content is empty")
+	}
+	switch scope {
+	case "", MemoryScopeProject:
+		scope = MemoryScopeProject
+	case MemoryScopeUser:
+		project = ""
+	default:
+		return Memory{}, fmt.Errorf("unknown memory scope %q, use %q or %q", scope, MemoryScopeProject, MemoryScopeUser)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var memory Memory
+	err := s.update(func() {
+		memory = Memory{
+			ID:      fmt.Sprintf("m%d", s.nextID),
+			Scope:   scope,
+			Project: project,
+			Content: content,
+			Created: time.Now(),
+		}
+		s.nextID++
+		s.memories = append(s.memories, memory)
+	})
+	if err != nil {
+		return Memory{}, err
+	}
+	return memory, nil
+}
+
+// Forget deletes a memory visible in project by ID, returns false if there was none
+func (s *MemoryStore) Forget(project string, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	err := s.update(func() {
+		for i, memory := range s.memories {
+			if memory.ID == id && memory.visibleIn(project) {
+				s.memories = append(s.memories[:i], s.memories[i+1:]...)
+				found = true
+				return
+			}
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+// visibleIn reports whether the memory applies in project, user-scoped memories apply everywhere
+func (memory Memory) visibleIn(project string) bool {
+	return memory.Scope == MemoryScopeUser || memory.Project == project
+}
+
+// Visible returns the user-scoped memories plus those of project, newest first.
+// Other sessions' memories are included, if the file can't be re-read the last copy is used.
+func (s *MemoryStore) Visible(project string) []Memory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// On error load keeps the last copy
+	s.load()
+	var visible []Memory
+	for _, memory := range s.memories {
+		if memory.visibleIn(project) {
+			visible = append(visible, memory)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		return visible[i].Created.After(visible[j].Created)
+	})
+	return visible
+}
+
+// Recall returns the visible memories matching query, best match first.
+//
+// Matching is by shared words, an empty query returns everything visible.
+func (s *MemoryStore) Recall(project string, query string) []Memory {
+	visible := s.Visible(project)
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return visible
+	}
+
+	type scored struct {
+		memory Memory
+		score  int
+	}
+	var matches []scored
+	for _, memory := range visible {
+		content := strings.ToLower(memory.Content)
+		score := 0
+		for _, word := range words {
+			if strings.Contains(content, word) {
+				score++
+			}
+		}
+		if score > 0 {
+			matches = append(matches, scored{memory, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]Memory, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, match.memory)
+	}
+	return result
+}
+
+// FormatMemories renders memories one per line as "[id] (scope) content"
+func FormatMemories(memories []Memory) string {
+	var sb strings.Builder
+	for _, memory := range memories {
+		sb.WriteString(fmt.Sprintf("[%s] (%s) %s\n", memory.ID, memory.Scope, memory.Content))
+	}
+	return sb.String()
+}
+
+// ProjectRoot identifies the current project for memory scoping:
+// the git top-level directory, or the working directory outside of git.
+func ProjectRoot() string {
+	if out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output(); err == nil {
+		if root := strings.TrimSpace(string(out)); root != "" {
+			return filepath.Clean(root)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return cwd
+}
+
+// memoriesPrompt renders remembered facts as a system prompt section, "" if there are none.
+//
+// memories must be newest first. Only the newest MaxPromptMemories go in the prompt,
+// the rest are left to the recall tool, which searches them all.
+func memoriesPrompt(memories []Memory) string {
+	if len(memories) == 0 {
+		return ""
+	}
+	if len(memories) > MaxPromptMemories {
+		memories = memories[:MaxPromptMemories]
+	}
+	return "\n\nThings you remembered from earlier sessions (use recall to search for more, forget to remove wrong ones):\n" + FormatMemories(memories)
+}
+
+// memoryStore returns the agent's memory store, or why it is unavailable
+func (a *Agent) memoryStore() (*MemoryStore, error) {
+	if a.memory == nil {
+		if a.memoryErr != nil {
+			return nil, fmt.Errorf("memory is unavailable: %v", a.memoryErr)
+		}
+		return nil, fmt.Errorf("memory is unavailable")
+	}
+	return a.memory, nil
+}
+
+// Remember saves a fact for this project, or for every project with MemoryScopeUser
+func (a *Agent) Remember(scope string, content string) (Memory, error) {
+	store, err := a.memoryStore()
+	if err != nil {
+		return Memory{}, err
+	}
+	return store.Remember(scope, a.project, content)
+}
+
+// Recall searches the memories visible in this project
+func (a *Agent) Recall(query string) ([]Memory, error) {
+	store, err := a.memoryStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Recall(a.project, query), nil
+}
+
+// Forget deletes a memory by ID, only memories visible in this project can be deleted
+func (a *Agent) Forget(id string) (bool, error) {
+	store, err := a.memoryStore()
+	if err != nil {
+		return false, err
+	}
+	return store.Forget(a.project, id)
+}
+
+// Memories returns every memory visible in this project, newest first
+func (a *Agent) Memories() ([]Memory, error) {
+	store, err := a.memoryStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.Visible(a.project), nil
+}
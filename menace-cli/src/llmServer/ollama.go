@@ -0,0 +1,205 @@
+package llmServer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// OllamaHostEnv is the environment variable Ollama itself reads for the server address
+const OllamaHostEnv = "OLLAMA_HOST"
+
+// OllamaHost is the base URL of the Ollama server, from OLLAMA_HOST.
+//
+// The host defaults to 127.0.0.1. Without a scheme it is http on Ollama's port 11434,
+// an explicit http:// or https:// without a port uses that scheme's port, 80 or 443.
+func OllamaHost() string {
+	host := strings.TrimSuffix(strings.TrimSpace(os.Getenv(OllamaHostEnv)), "/")
+	defaultPort := "11434"
+	scheme, hostport, ok := strings.Cut(host, "://")
+	switch {
+	case !ok:
+		scheme, hostport = "http", host
+	case scheme == "http":
+		defaultPort = "80"
+	case scheme == "https":
+		defaultPort = "443"
+	}
+	hostname, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		hostname, port = strings.Trim(hostport, "[]"), defaultPort
+	}
+	if hostname == "" || hostname == "0.0.0.0" {
+		hostname = "127.0.0.1"
+	}
+	return scheme + "://" + net.JoinHostPort(hostname, port)
+}
+
+// OllamaModel is a model installed on the Ollama server
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Size       int64              `json:"size"`
+	ModifiedAt time.Time          `json:"modified_at"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+// OllamaModelDetails describes an Ollama model's weights
+type OllamaModelDetails struct {
+	Family string `json:"family"`
+	// ParameterSize is e.g. "8.0B"
+	ParameterSize string `json:"parameter_size"`
+	// QuantizationLevel is e.g. "Q4_K_M"
+	QuantizationLevel string `json:"quantization_level"`
+}
+
+// OllamaModelInfo is what the Ollama server knows about one model
+type OllamaModelInfo struct {
+	Details OllamaModelDetails
+	// ContextLength is the longest context the model was trained for, 0 if unknown
+	ContextLength int
+	// Parameters are the model's default runtime options, one "name value" per line
+	Parameters   string
+	Capabilities []string
+	License      string
+}
+
+// OllamaProgress is a status update while pulling a model
+type OllamaProgress struct {
+	Status string `json:"status"`
+	// Total and Completed are bytes of the layer being downloaded, 0 between layers
+	Total     int64  `json:"total"`
+	Completed int64  `json:"completed"`
+	Error     string `json:"error"`
+}
+
+// ollamaRequest sends a JSON request to the Ollama server, returning the response if it succeeded
+func ollamaRequest(ctx context.Context, method string, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, OllamaHost()+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The url.Error repeats the URL
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("Ollama isn't reachable at %s: %v", OllamaHost(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var apiError struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiError) != nil || apiError.Error == "" {
+			return nil, fmt.Errorf("Ollama request failed with status: %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("Ollama: %s", apiError.Error)
+	}
+	return resp, nil
+}
+
+// ListOllamaModels returns the models installed on the Ollama server
+func ListOllamaModels(ctx context.Context) ([]OllamaModel, error) {
+	resp, err := ollamaRequest(ctx, http.MethodGet, "/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("error decoding Ollama models: %v", err)
+	}
+	return tags.Models, nil
+}
+
+// ShowOllamaModel returns the details of an installed model
+func ShowOllamaModel(ctx context.Context, name string) (OllamaModelInfo, error) {
+	resp, err := ollamaRequest(ctx, http.MethodPost, "/api/show", map[string]string{"model": name})
+	if err != nil {
+		return OllamaModelInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	var show struct {
+		Details      OllamaModelDetails     `json:"details"`
+		Parameters   string                 `json:"parameters"`
+		License      string                 `json:"license"`
+		Capabilities []string               `json:"capabilities"`
+		ModelInfo    map[string]interface{} `json:"model_info"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil {
+		return OllamaModelInfo{}, fmt.Errorf("error decoding model %s: %v", name, err)
+	}
+	info := OllamaModelInfo{
+		Details:      show.Details,
+		Parameters:   strings.TrimSpace(show.Parameters),
+		Capabilities: show.Capabilities,
+		License:      show.License,
+	}
+	// The key is prefixed with the architecture, e.g. "llama.context_length"
+	for key, value := range show.ModelInfo {
+		if length, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") {
+			info.ContextLength = int(length)
+		}
+	}
+	return info, nil
+}
+
+// PullOllamaModel downloads a model, or updates an installed one, calling progress for every status update
+func PullOllamaModel(ctx context.Context, name string, progress func(OllamaProgress)) error {
+	resp, err := ollamaRequest(ctx, http.MethodPost, "/api/pull", map[string]string{"model": name})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The response is one JSON object per line until the pull finishes
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var update OllamaProgress
+		if err := json.Unmarshal(scanner.Bytes(), &update); err != nil {
+			return fmt.Errorf("error decoding pull progress: %v", err)
+		}
+		if update.Error != "" {
+			return fmt.Errorf("pulling %s: %s", name, update.Error)
+		}
+		progress(update)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pulling %s: %v", name, err)
+	}
+	return nil
+}
+
+// DeleteOllamaModel removes an installed model
+func DeleteOllamaModel(ctx context.Context, name string) error {
+	resp, err := ollamaRequest(ctx, http.MethodDelete, "/api/delete", map[string]string{"model": name})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
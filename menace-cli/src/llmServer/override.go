@@ -0,0 +1,66 @@
+package llmServer
+
+import (
+	"github.com/tmc/langchaingo/llms"
+)
+
+// TaskOverride temporarily swaps the model and tool list, e.g. while running a custom command.
+//
+// Empty fields keep the agent's current setting. It stays active until ClearOverride.
+type TaskOverride struct {
+	Provider string
+	Model    string
+	Tools    []string
+	llm      llms.Model
+}
+
+// SetOverride activates a task override, creating the override model's client up front
+func (a *Agent) SetOverride(override TaskOverride) error {
+	if override.Model != "" {
+		if override.Provider == "" {
+			override.Provider = a.currentProvider()
+		}
+		llm, err := a.newLLM(override.Provider, override.Model)
+		if err != nil {
+			return err
+		}
+		override.llm = llm
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.override = &override
+	return nil
+}
+
+// ClearOverride goes back to the agent's own model and the persona's tools
+func (a *Agent) ClearOverride() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.override = nil
+}
+
+// currentProvider returns the provider of the agent's own model
+func (a *Agent) currentProvider() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.provider
+}
+
+// activeModel returns the client, provider and model to use for the next request,
+// honouring any override. Caller must hold a.mu.
+func (a *Agent) activeModel() (llms.Model, string, string) {
+	if a.override != nil && a.override.llm != nil {
+		return a.override.llm, a.override.Provider, a.override.Model
+	}
+	return a.llm, a.provider, a.Model
+}
+
+// allowedTools returns the tool list in force and where it comes from, nil means everything.
+// Caller must hold a.mu.
+func (a *Agent) allowedTools() ([]string, string) {
+	if a.override != nil && len(a.override.Tools) > 0 {
+		return a.override.Tools, "this command"
+	}
+	return a.personas[a.persona].Tools, "the " + a.persona + " persona"
+}
@@ -0,0 +1,217 @@
+package llmServer
+
+import (
+	"fmt"
+	"menace-go/config"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// DefaultPersona is the persona with no prompt changes
+const DefaultPersona = "default"
+
+// ShellTool is the tool name that allows [COMMAND_SUGGESTION] blocks in a persona's tool list
+const ShellTool = "shell"
+
+// BuiltinPersonas ship with Menace, config personas with the same name replace them
+var BuiltinPersonas = map[string]config.Persona{
+	DefaultPersona: {
+		Description: "General purpose terminal assistant",
+	},
+	"reviewer": {
+		Description: "Reviews code and diffs, never changes files",
+		Prompt: `Act as a meticulous code reviewer. Read the code you are asked about and report bugs, races, missing error handling and unclear naming, most severe first, citing file and line.
+Do not modify files; suggest changes as snippets instead.`,
+		// No shell, a command can change files as easily as an edit
+		Tools: []string{"ReadFileWithLineNumbers", "recall"},
+	},
+	"ops": {
+		Description: "Cautious operations engineer, asks before changing anything",
+		Prompt: `Act as a cautious operations engineer on {{os}} using {{shell}}.
+Prefer read-only diagnostics first. Before anything that changes system state, explain the blast radius and how to roll it back, and always set AwaitingCommandApproval to true for such commands.`,
+	},
+	"teacher": {
+		Description: "Explains what it does and why, step by step",
+		Prompt: `Act as a patient teacher. Before each command or edit, explain what it does and the concept behind it in plain language.
+After finishing, summarise what the user can do on their own next time.`,
+	},
+	"terse": {
+		Description: "Minimal answers, no explanations unless asked",
+		Prompt:      `Be terse. Answer in as few words as possible, skip pleasantries and explanations unless asked. Reasons in blocks should be a few words.`,
+	},
+}
+
+// expandPersonaTemplate fills in the {{shell}}, {{cwd}} and {{os}} placeholders
+func expandPersonaTemplate(template string, shell string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = "unknown directory"
+	}
+	return strings.NewReplacer(
+		"{{shell}}", shell,
+		"{{cwd}}", cwd,
+		"{{os}}", runtime.GOOS,
+	).Replace(template)
+}
+
+// personaPrompt builds the system prompt for persona, replacing or extending the built-in one
+func personaPrompt(persona config.Persona, shell string) string {
+	prompt := getSystemPrompt(shell)
+	if persona.SystemPrompt != "" {
+		prompt = expandPersonaTemplate(persona.SystemPrompt, shell) + instructionsPrompt(FindInstructionFiles())
+	}
+	if persona.Prompt != "" {
+		prompt += "\n\nPersona instructions:\n" + expandPersonaTemplate(persona.Prompt, shell)
+	}
+	if len(persona.Tools) > 0 {
+		prompt += "\n\nYou may only use these tools: " + strings.Join(persona.Tools, ", ") +
+			". (\"" + ShellTool + "\" means [COMMAND_SUGGESTION] blocks.) Anything else will be rejected."
+	}
+	return prompt
+}
+
+// SetPersonas registers the personas from the config on top of the built-in ones.
+//
+// A persona naming a tool that doesn't exist is skipped, returns one error per skipped persona.
+func (a *Agent) SetPersonas(personas map[string]config.Persona) []error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.personas = make(map[string]config.Persona, len(BuiltinPersonas)+len(personas))
+	for name, persona := range BuiltinPersonas {
+		a.personas[name] = persona
+	}
+
+	names := make([]string, 0, len(personas))
+	for name := range personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		persona := personas[name]
+		if tool, ok := unknownTool(persona.Tools); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown tool %q", name, tool))
+			continue
+		}
+		a.personas[name] = persona
+	}
+	return errs
+}
+
+// unknownTool returns the first of tools that isn't ShellTool or an available function, ok if there is none
+func unknownTool(tools []string) (string, bool) {
+	for _, tool := range tools {
+		if tool != ShellTool && !IsAvailableFunction(tool) {
+			return tool, false
+		}
+	}
+	return "", true
+}
+
+// Personas returns the sorted names of all available personas
+func (a *Agent) Personas() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	names := make([]string, 0, len(a.personas))
+	for name := range a.personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PersonaInfo returns a persona definition by name
+func (a *Agent) PersonaInfo(name string) (config.Persona, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	persona, ok := a.personas[name]
+	return persona, ok
+}
+
+// Persona returns the name of the active persona
+func (a *Agent) Persona() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.persona
+}
+
+// SetPersona switches persona mid-session, keeping the conversation.
+//
+// The system prompt is rebuilt and, if the persona names a model, the model is switched too.
+// Switching to a persona without a model goes back to the model from before.
+func (a *Agent) SetPersona(name string) error {
+	a.mu.Lock()
+	persona, ok := a.personas[name]
+	previous := personaModelSwitch{provider: a.provider, model: a.Model, openSource: a.isOpenSource}
+	switched := a.personaSwitch
+	a.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown persona %q", name)
+	}
+
+	switch {
+	case persona.Model != "":
+		provider := previous.provider
+		if persona.Provider != "" {
+			provider = persona.Provider
+		}
+		if err := a.SetModel(provider, persona.Model, provider == "ollama"); err != nil {
+			return err
+		}
+		// Keep the model from before the first persona that switched it
+		if switched != nil {
+			previous = *switched
+		}
+		previous.personaProvider, previous.personaModel = provider, persona.Model
+		switched = &previous
+	case switched != nil:
+		// Go back to the model the last persona replaced, unless it was changed since
+		if previous.provider == switched.personaProvider && previous.model == switched.personaModel {
+			if err := a.SetModel(switched.provider, switched.model, switched.openSource); err != nil {
+				return err
+			}
+		}
+		switched = nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.personaSwitch = switched
+	a.persona = name
+	a.messages[0] = systemMessage(a.systemPrompt())
+	return nil
+}
+
+// personaModelSwitch records a model change made by a persona, see SetPersona
+type personaModelSwitch struct {
+	// provider, model and openSource are the model before the persona switched it
+	provider   string
+	model      string
+	openSource bool
+	// personaProvider and personaModel are the model the persona switched to
+	personaProvider string
+	personaModel    string
+}
+
+// ToolAllowed reports whether tool may be used under the active persona or override
+func (a *Agent) ToolAllowed(tool string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.toolAllowed(tool)
+}
+
+// toolAllowed reports whether tool may be used under the active persona or override, caller must hold a.mu
+func (a *Agent) toolAllowed(tool string) bool {
+	tools, _ := a.allowedTools()
+	if len(tools) == 0 {
+		return true
+	}
+	for _, allowed := range tools {
+		if allowed == tool {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package llmServer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// PinFile adds a file whose current contents are sent with every message.
+//
+// Paths are stored relative to the working directory when possible, see pinPath.
+func (a *Agent) PinFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	path = pinPath(path)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, pinned := range a.pinned {
+		if pinned == path {
+			return path, nil
+		}
+	}
+	a.pinned = append(a.pinned, path)
+	return path, nil
+}
+
+// pinPath is path relative to the working directory, or absolute if it is outside of it,
+// so the same file always has the same entry in the pin list
+func pinPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return abs
+	}
+	return rel
+}
+
+// UnpinFile removes a pinned file, returns false if it wasn't pinned
+func (a *Agent) UnpinFile(path string) bool {
+	path = pinPath(path)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, pinned := range a.pinned {
+		if pinned == path {
+			a.pinned = append(a.pinned[:i], a.pinned[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// UnpinAll clears the pin list
+func (a *Agent) UnpinAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.pinned = nil
+}
+
+// PinnedFiles returns a copy of the pin list
+func (a *Agent) PinnedFiles() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.pinned...)
+}
+
+// contextMessages returns the history to send to the LLM for this turn.
+//
+// Pinned files are re-read and injected right before the newest message. The snapshot is
+// never stored in a.messages, so each turn replaces the previous one instead of piling up.
+// It is a human message, providers like Anthropic fold system messages into the system prompt.
+// Caller must hold a.mu.
+func (a *Agent) contextMessages() []llms.MessageContent {
+	if len(a.pinned) == 0 || len(a.messages) == 0 {
+		return a.messages
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Current contents of the pinned files, re-read just now. These supersede any earlier copy of the same file in this conversation; use these line numbers.")
+	for _, path := range a.pinned {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			sb.WriteString(fmt.Sprintf("\n\n<file path=%q>\nunavailable: %v\n</file>", path, err))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n\n<file path=%q>\n%s</file>", path, numberLines(string(data))))
+	}
+	snapshot := llms.MessageContent{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.TextContent{Text: sb.String()}},
+	}
+
+	last := len(a.messages) - 1
+	messages := make([]llms.MessageContent, 0, len(a.messages)+1)
+	messages = append(messages, a.messages[:last]...)
+	messages = append(messages, snapshot, a.messages[last])
+	return messages
+}
+
+// numberLines prefixes each line with its 1-based line number, same format as ReadFileWithLineNumbers
+func numberLines(content string) string {
+	var sb strings.Builder
+	for i, line := range strings.Split(content, "\n") {
+		sb.WriteString(fmt.Sprintf("%d: %s\n", i+1, line))
+	}
+	return sb.String()
+}
@@ -0,0 +1,134 @@
+package llmServer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ParseError describes why a [COMMAND_SUGGESTION] or [FUNCTION_CALL] block
+// in an LLM response could not be turned into something we can execute.
+//
+// Block is the tag name, Field is the offending field ("" if the whole block is bad).
+type ParseError struct {
+	Block  string
+	Field  string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("malformed [%s] block: %s", e.Block, e.Reason)
+	}
+	return fmt.Sprintf("malformed [%s] block, field %q: %s", e.Block, e.Field, e.Reason)
+}
+
+// responseBlock is the raw result of pulling a tagged block out of an LLM response
+type responseBlock struct {
+	Fields    map[string]string // keyed by lower-cased field name
+	Narrative string            // everything in the response outside of the block
+}
+
+// Matches a "Key:" line, e.g. "  Reason: foo" or "- command : ls"
+var blockFieldPattern = regexp.MustCompile(`^\s*[-*]?\s*([A-Za-z_]+)\s*:(.*)$`)
+
+// findBlock locates the first [tag]...[/tag] block in response and splits it into fields.
+//
+// Fields may appear in any order and span multiple lines; a field runs until the next
+// recognised field name. Lines inside ``` fences never start a new field.
+// A missing closing tag is tolerated, the block then runs to the end of the response.
+//
+// Returns: block, found, error
+func findBlock(response string, tag string, fieldNames []string) (*responseBlock, bool, error) {
+	// Tags are matched case-insensitively on response itself, lowercasing a copy
+	// could change its byte length and misalign the offsets
+	openTag := regexp.MustCompile(`(?i)` + regexp.QuoteMeta("["+tag+"]"))
+	closeTag := regexp.MustCompile(`(?i)` + regexp.QuoteMeta("[/"+tag+"]"))
+
+	open := openTag.FindStringIndex(response)
+	if open == nil {
+		return nil, false, nil
+	}
+	start, bodyStart := open[0], open[1]
+	var body, after string
+	if end := closeTag.FindStringIndex(response[bodyStart:]); end == nil {
+		body = response[bodyStart:]
+	} else {
+		body = response[bodyStart : bodyStart+end[0]]
+		after = response[bodyStart+end[1]:]
+	}
+
+	known := make(map[string]bool, len(fieldNames))
+	for _, name := range fieldNames {
+		known[strings.ToLower(name)] = true
+	}
+
+	fields := map[string]string{}
+	var current string
+	var value []string
+	inFence := false
+	flush := func() {
+		if current != "" {
+			fields[current] = strings.TrimSpace(strings.Join(value, "\n"))
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !inFence {
+			if match := blockFieldPattern.FindStringSubmatch(line); match != nil && known[strings.ToLower(match[1])] {
+				flush()
+				current = strings.ToLower(match[1])
+				value = []string{match[2]}
+				if strings.Count(match[2], "```")%2 == 1 {
+					inFence = true
+				}
+				continue
+			}
+		}
+		if strings.Count(line, "```")%2 == 1 {
+			inFence = !inFence
+		}
+		if current != "" {
+			value = append(value, line)
+		}
+	}
+	flush()
+
+	if len(fields) == 0 {
+		return nil, true, &ParseError{Block: tag, Reason: "block contains none of the expected fields " + strings.Join(fieldNames, ", ")}
+	}
+
+	narrative := strings.TrimSpace(strings.TrimSpace(response[:start]) + "\n\n" + strings.TrimSpace(after))
+	return &responseBlock{Fields: fields, Narrative: narrative}, true, nil
+}
+
+// parseBool accepts the handful of spellings models actually use for booleans
+func parseBool(tag string, field string, raw string) (bool, error) {
+	switch strings.ToLower(strings.Trim(strings.TrimSpace(raw), "`\"'.")) {
+	case "true", "yes", "y", "1":
+		return true, nil
+	case "false", "no", "n", "0":
+		return false, nil
+	}
+	return false, &ParseError{Block: tag, Field: field, Reason: fmt.Sprintf("expected true or false, got %q", raw)}
+}
+
+// stripCodeFence removes a surrounding ```lang ... ``` fence or `inline` backticks from a value
+func stripCodeFence(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "```") {
+		value = strings.TrimPrefix(value, "```")
+		if nl := strings.Index(value, "\n"); nl != -1 {
+			// first line is the language tag (if any)
+			if tagLine := strings.TrimSpace(value[:nl]); !strings.Contains(tagLine, " ") {
+				value = value[nl+1:]
+			}
+		}
+		value = strings.TrimSuffix(strings.TrimSpace(value), "```")
+		return strings.TrimSpace(value)
+	}
+	if len(value) > 1 && strings.HasPrefix(value, "`") && strings.HasSuffix(value, "`") {
+		return strings.TrimSpace(strings.Trim(value, "`"))
+	}
+	return value
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 )
 
+// Includes any MENACE.md project instructions, see FindInstructionFiles.
+//
 // Returns: System prompt
 func getSystemPrompt(shell string) string {
 	cwd, err := os.Getwd()
@@ -19,7 +21,8 @@ func getSystemPrompt(shell string) string {
 	You can also edit files, write code, etc. if it is required to finish the task.
 	When performing tasks, always ensure that every step is achieves exactly what the user requests.
 	Do not write code, or run commands unless you are certain it is necessary.
-	When uncertain, ask clarifying questions.
+	When uncertain, ask clarifying questions. If the answer is one of a few choices, call the "askUser" function with AwaitingCommandApproval: false and
+	args {"question": "<the question>", "options": ["<choice>", "<choice>"]} (at most 9 options). The user picks an option or types their own answer, which is returned as the function output.
 
 	You also have access to Github. You can stage files ('git add .'), commit changes ('git commit -m make the commit message'), and push ('git push' or 'git push origin <branch_name>') to repository using commands. You can also create pull requests using functions.
 	The function to call for pull requests is called createPullRequest and takes in a string for the branch_name, title, and summary. Generate the title and summary on your own. If the user doesn't provide something, assume current branch or generate the data piece yourself.
@@ -78,8 +81,8 @@ func getSystemPrompt(shell string) string {
 	{
 		"name": "createPullRequest",
 		"args": {
-			"branch_name": "add-new-feature"
-			"title": "Add new feature"
+			"branch_name": "add-new-feature",
+			"title": "Add new feature",
 			"summary": "This is a summary of the pull request"
 		}
 	}
@@ -119,6 +122,12 @@ func getSystemPrompt(shell string) string {
 	}
 	[/FUNCTION_CALL]
 
+	You have a long-term memory that survives restarts and cleared conversations. Use these functions with AwaitingCommandApproval: false:
+	- "remember" with args {"content": "<one short fact>", "scope": "project" or "user"} saves a fact. Use "user" only for facts that apply in every project.
+	- "recall" with args {"query": "<keywords>"} searches saved facts.
+	- "forget" with args {"id": "<memory id>"} deletes a fact that turned out to be wrong.
+	Remember durable, non-obvious facts you learn, such as environment quirks, branch names or commands that need special flags. Do not remember secrets or things obvious from the code.
+
 	You can edit files, write code from the functions, and search for files and functions using commands.
 
 	If you need to edit a file:
@@ -143,7 +152,7 @@ func getSystemPrompt(shell string) string {
 	will give you feedback and direction on what to do next.
 
 	You should respond as if you are part of this real application, not a fictional tool.
-	`, shell, shell, cwd)
+	`, shell, shell, cwd) + instructionsPrompt(FindInstructionFiles())
 }
 
 
@@ -161,7 +170,8 @@ func getSystemPromptNew(shell string) string {
 	You can also edit files, write code, etc. if it is required to finish the task.
 	When performing tasks, always ensure that every step is achieves exactly what the user requests.
 	Do not write code, or run commands unless you are certain it is necessary.
-	When uncertain, ask clarifying questions.
+	When uncertain, ask clarifying questions. If the answer is one of a few choices, call the "askUser" function with AwaitingCommandApproval: false and
+	args {"question": "<the question>", "options": ["<choice>", "<choice>"]} (at most 9 options). The user picks an option or types their own answer, which is returned as the function output.
 
 	You also have access to Github. You can stage files ('git add .'), commit changes ('git commit -m make the commit message'), and push ('git push' or 'git push origin <branch_name>') to repository using commands. You can also create pull requests using functions.
 	The function to call for pull requests is called createPullRequest and takes in a string for the branch_name, title, and summary. Generate the title and summary on your own. If the user doesn't provide something, assume current branch or generate the data piece yourself.
@@ -269,8 +279,8 @@ func getSystemPromptNew(shell string) string {
 		"function_call": {
 			"name": "createPullRequest",
 			"args": {
-				"branch_name": "add-new-feature"
-				"title": "Add new feature"
+				"branch_name": "add-new-feature",
+				"title": "Add new feature",
 				"summary": "This is a summary of the pull request"
 			}
 		},
@@ -0,0 +1,93 @@
+package llmServer
+
+import (
+	"strings"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// ModelPrices is keyed by model ID prefix, the longest matching prefix wins.
+// Models not listed (including every Ollama model) are treated as free.
+var ModelPrices = map[string]ModelPrice{
+	"gpt-4-0125-preview": {Input: 10, Output: 30},
+	"gpt-4-1106-preview": {Input: 10, Output: 30},
+	"gpt-4.1":            {Input: 2, Output: 8},
+	"gpt-4o":             {Input: 2.5, Output: 10},
+	"gpt-3.5-turbo":      {Input: 0.5, Output: 1.5},
+	"o4-mini":            {Input: 1.1, Output: 4.4},
+	"o3":                 {Input: 2, Output: 8},
+	"claude-3-opus":      {Input: 15, Output: 75},
+	"claude-3-5-sonnet":  {Input: 3, Output: 15},
+	"claude-3-haiku":     {Input: 0.25, Output: 1.25},
+}
+
+// PriceFor returns the price of a model and whether it is known
+func PriceFor(provider string, model string) (ModelPrice, bool) {
+	if provider == "ollama" {
+		return ModelPrice{}, true
+	}
+	var best string
+	for prefix := range ModelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return ModelPrices[best], true
+}
+
+// Usage is the token usage of the session so far
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+	Requests     int
+	// Cost in USD of the requests to models with a known price
+	Cost float64
+	// UnpricedRequests counts requests to models missing from ModelPrices
+	UnpricedRequests int
+}
+
+// recordUsage adds the token counts from a response's GenerationInfo for model, caller must hold a.mu.
+//
+// OpenAI and Ollama report PromptTokens/CompletionTokens, Anthropic InputTokens/OutputTokens.
+func (a *Agent) recordUsage(provider string, model string, info map[string]any) {
+	input := intFromInfo(info, "PromptTokens") + intFromInfo(info, "InputTokens")
+	output := intFromInfo(info, "CompletionTokens") + intFromInfo(info, "OutputTokens")
+
+	a.usage.Requests++
+	a.usage.InputTokens += input
+	a.usage.OutputTokens += output
+	if price, ok := PriceFor(provider, model); ok {
+		a.usage.Cost += (float64(input)*price.Input + float64(output)*price.Output) / 1e6
+	} else {
+		a.usage.UnpricedRequests++
+	}
+}
+
+// Usage returns the token usage of the session so far
+func (a *Agent) Usage() Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.usage
+}
+
+// intFromInfo reads a token count that may be stored as any integer type
+func intFromInfo(info map[string]any, key string) int {
+	switch v := info[key].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
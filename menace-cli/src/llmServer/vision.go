@@ -0,0 +1,90 @@
+package llmServer
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// MaxImageBytes is the largest image we will attach to a prompt
+const MaxImageBytes = 20 << 20
+
+// ImageAttachment is an image the user attached to a prompt
+type ImageAttachment struct {
+	Name     string // file name, or "clipboard.png" for pasted images
+	MIMEType string
+	Data     []byte
+}
+
+// Model name fragments of vision-capable models, per provider.
+//
+// Anthropic is missing on purpose: the langchaingo anthropic client only sends
+// the first text part of a human message, so images would be silently dropped.
+var visionModels = map[string][]string{
+	"openai": {"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-4-vision", "o1", "o3", "o4"},
+	"ollama": {"llava", "bakllava", "vision", "moondream", "gemma3", "qwen2.5vl", "minicpm-v", "mistral-small3"},
+}
+
+// SupportsVision reports whether the given model can take image input
+func SupportsVision(provider string, model string) bool {
+	model = strings.ToLower(model)
+	for _, fragment := range visionModels[provider] {
+		if strings.Contains(model, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsVision reports whether the agent's current model can take image input
+func (a *Agent) SupportsVision() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, provider, model := a.activeModel()
+	return SupportsVision(provider, model)
+}
+
+// LoadImageAttachment reads an image file from disk for attaching to a prompt
+//
+// Returns an error if the file is not an image or is too large.
+func LoadImageAttachment(path string) (*ImageAttachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > MaxImageBytes {
+		return nil, fmt.Errorf("%s is larger than %d MB", path, MaxImageBytes>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewImageAttachment(filepath.Base(path), data)
+}
+
+// NewImageAttachment wraps raw image bytes, sniffing the MIME type from the data
+func NewImageAttachment(name string, data []byte) (*ImageAttachment, error) {
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, fmt.Errorf("%s is not an image (%s)", name, mimeType)
+	}
+	return &ImageAttachment{Name: name, MIMEType: mimeType, Data: data}, nil
+}
+
+// imagePart converts an attachment into the content part the provider understands.
+//
+// The OpenAI client needs a data URL, Ollama takes the raw bytes.
+func imagePart(provider string, image ImageAttachment) llms.ContentPart {
+	binary := llms.BinaryContent{MIMEType: image.MIMEType, Data: image.Data}
+	if provider == "openai" {
+		return llms.ImageURLContent{URL: binary.String()}
+	}
+	return binary
+}
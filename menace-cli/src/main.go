@@ -1,7 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"menace-go/config"
 	"menace-go/llmServer"
 	"menace-go/ui"
 	"os"
@@ -11,10 +13,30 @@ import (
 )
 
 func main() {
+	noColor := flag.Bool("no-color", false, "disable colors (also set by the NO_COLOR environment variable)")
+	flag.Parse()
+
+	// Load user and project config, personas are applied to the agent
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	// API keys from the config fill in for unset environment variables
+	for provider, key := range cfg.APIKeys {
+		if env := llmServer.APIKeyEnv[provider]; env != "" && os.Getenv(env) == "" {
+			os.Setenv(env, key)
+		}
+	}
+	// So does the Ollama host
+	if cfg.Ollama.Host != "" && os.Getenv(llmServer.OllamaHostEnv) == "" {
+		os.Setenv(llmServer.OllamaHostEnv, cfg.Ollama.Host)
+	}
+
 	// Get API key
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		fmt.Println("Error: OPENAI_API_KEY environment variable not set")
+		fmt.Println("Error: OPENAI_API_KEY environment variable not set (or set \"api_keys\": {\"openai\": ...} in " + config.UserFile() + ")")
 		os.Exit(1)
 	}
 
@@ -24,11 +46,46 @@ func main() {
 		fmt.Printf("Error initializing agent: %v\n", err)
 		os.Exit(1)
 	}
+	agent.SetOllamaOptions(cfg.Ollama.Models)
+	if cfg.Model != "" {
+		provider := cfg.Provider
+		if provider == "" {
+			provider = "openai"
+		}
+		if err := agent.SetModel(provider, cfg.Model, provider == "ollama"); err != nil {
+			fmt.Printf("Error selecting model: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	agent.SetGeneration(cfg.Generation)
+	agent.SetShell(cfg.Shell)
+	personaErrs := agent.SetPersonas(cfg.Personas)
+	if cfg.DefaultPersona != "" {
+		if err := agent.SetPersona(cfg.DefaultPersona); err != nil {
+			for _, personaErr := range personaErrs {
+				fmt.Printf("Skipped persona: %v\n", personaErr)
+			}
+			fmt.Printf("Error selecting persona: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// See https://no-color.org, an empty NO_COLOR doesn't count
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		ui.DisableColor()
+	}
+
+	// Query the terminal before Bubble Tea takes over stdin
+	ui.DetectBackground()
 
 	// Initialize UI with the agent
 	zone.NewGlobal()
+	model := ui.NewModel(agent, cfg)
+	for _, err := range personaErrs {
+		model.AddSystemMessage("Skipped persona: " + err.Error())
+	}
 	p := tea.NewProgram(
-		ui.NewModel(agent), // Pass the agent to the UI
+		model, // Pass the agent and config to the UI
 		tea.WithAltScreen(),
 		tea.WithMouseAllMotion(),
 	)
@@ -0,0 +1,122 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/llmServer"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	zone "github.com/lrstanley/bubblezone"
+	"github.com/mattn/go-runewidth"
+)
+
+// OtherOptionLabel is the extra menu entry for answering in free text
+const OtherOptionLabel = "Other (type your answer)"
+
+// questionOptionZone is the bubblezone ID of option i, len(Options) is "Other"
+func questionOptionZone(i int) string {
+	return fmt.Sprintf("question-option-%d", i)
+}
+
+// AskQuestion shows the model's question as a menu above the input
+func (m *Model) AskQuestion(question *llmServer.Question) {
+	m.PendingQuestion = question
+	m.QuestionCursor = 0
+	m.AddResponse(KindAgent, question.Text)
+}
+
+// QuestionOpen reports whether a question from the model is waiting for an answer
+func (m *Model) QuestionOpen() bool {
+	return m.PendingQuestion != nil
+}
+
+// answerQuestion closes the question and sends the answer back as the askUser output
+func (m *Model) answerQuestion(answer string) tea.Cmd {
+	m.PendingQuestion = nil
+	m.QuestionCursor = 0
+	m.ClearState()
+	return m.SendToAgent(answer, fmt.Sprintf("Function %s executed. Output: %s", llmServer.AskUserFunction, answer))
+}
+
+// HandleQuestionKey handles keys that drive the question menu.
+//
+// Returns handled false for keys that should reach the input box, so "Other" answers can be typed.
+// With the input empty, the digits 1-9 pick the option with that number.
+func (m *Model) HandleQuestionKey(key string) (tea.Cmd, bool) {
+	other := len(m.PendingQuestion.Options)
+	if len(key) == 1 && key >= "1" && key <= "9" && m.Input == "" {
+		switch i := int(key[0] - '1'); {
+		case i < other:
+			return m.answerQuestion(m.PendingQuestion.Options[i]), true
+		case i == other:
+			m.QuestionCursor = other
+			return nil, true
+		}
+	}
+	switch m.keymap.Action(ScopeMenu, key) {
+	case ActionMenuUp:
+		if m.QuestionCursor > 0 {
+			m.QuestionCursor--
+		}
+		return nil, true
+	case ActionMenuDown:
+		if m.QuestionCursor < other {
+			m.QuestionCursor++
+		}
+		return nil, true
+	case ActionMenuClose:
+		m.PendingQuestion = nil
+		m.QuestionCursor = 0
+		return m.SendToAgent("(dismissed the question)", fmt.Sprintf("Function %s executed. Output: the user dismissed the question without answering.", llmServer.AskUserFunction)), true
+	case ActionMenuSelect:
+		// Typed text always wins, it is the "Other" answer
+		if answer := strings.TrimSpace(m.Input); answer != "" {
+			if cmd, handled := m.HandleSlashCommand(m.Input); handled {
+				return cmd, true
+			}
+			return m.answerQuestion(answer), true
+		}
+		if m.QuestionCursor < other {
+			return m.answerQuestion(m.PendingQuestion.Options[m.QuestionCursor]), true
+		}
+		m.AddSystemMessage("Type your answer, then press Enter")
+		return nil, true
+	}
+	return nil, false
+}
+
+// HandleQuestionClick picks the clicked option, clicking "Other" moves the cursor there for typing
+func (m *Model) HandleQuestionClick(msg tea.MouseMsg) (tea.Cmd, bool) {
+	for i, option := range m.PendingQuestion.Options {
+		if zone.Get(questionOptionZone(i)).InBounds(msg) {
+			return m.answerQuestion(option), true
+		}
+	}
+	if zone.Get(questionOptionZone(len(m.PendingQuestion.Options))).InBounds(msg) {
+		m.QuestionCursor = len(m.PendingQuestion.Options)
+		return nil, true
+	}
+	return nil, false
+}
+
+// renderQuestion draws the option menu above the input box
+func (m *Model) renderQuestion(width int) string {
+	options := append(append([]string{}, m.PendingQuestion.Options...), OtherOptionLabel)
+	lines := make([]string, 0, len(options)+1)
+	lines = append(lines, QuestionStyle.Render(runewidth.Truncate(m.PendingQuestion.Text, width, "…")))
+	for i, option := range options {
+		line := runewidth.Truncate(fmt.Sprintf("%d. %s", i+1, option), width-2, "…")
+		// Typing an answer selects "Other"
+		selected := i == m.QuestionCursor
+		if strings.TrimSpace(m.Input) != "" {
+			selected = i == len(options)-1
+		}
+		if selected {
+			line = CommandPopupSelectedStyle.Render("> " + line)
+		} else {
+			line = CommandPopupStyle.Render("  " + line)
+		}
+		lines = append(lines, zone.Mark(questionOptionZone(i), line))
+	}
+	return strings.Join(lines, "\n")
+}
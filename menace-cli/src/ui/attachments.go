@@ -0,0 +1,129 @@
+package ui
+
+import (
+	"encoding/base64"
+	"menace-go/llmServer"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// File extensions we treat as images when a path is pasted or dropped into the input
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".bmp": true,
+}
+
+// imagePathFromPaste returns the image path in pasted text, or "" if it isn't one.
+//
+// Terminals paste dropped files quoted, escaped or as file:// URLs, so all of those are unwrapped.
+func imagePathFromPaste(text string) string {
+	path := strings.TrimSpace(text)
+	if strings.Contains(path, "\n") {
+		return ""
+	}
+	path = strings.Trim(path, `"'`)
+	if strings.HasPrefix(path, "file://") {
+		if u, err := url.Parse(path); err == nil {
+			path = u.Path
+		}
+	}
+	if runtime.GOOS != "windows" {
+		path = strings.ReplaceAll(path, `\ `, " ")
+	}
+	if !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+		return ""
+	}
+	return path
+}
+
+// AttachImage attaches the image at path to the next prompt.
+//
+// Reports problems as system messages, returns true if the image was attached.
+func (m *Model) AttachImage(path string) bool {
+	if !m.agent.SupportsVision() {
+		m.AddSystemMessage("Model " + m.agent.Model + " does not support images, switch to a vision model to attach " + filepath.Base(path))
+		return false
+	}
+	image, err := llmServer.LoadImageAttachment(path)
+	if err != nil {
+		m.AddSystemMessage("Failed to attach image: " + err.Error())
+		return false
+	}
+	m.Attachments = append(m.Attachments, *image)
+	return true
+}
+
+// AttachClipboardImage attaches an image copied to the system clipboard, if there is one
+func (m *Model) AttachClipboardImage() bool {
+	data := m.GetClipboardImage()
+	if len(data) == 0 {
+		return false
+	}
+	if !m.agent.SupportsVision() {
+		m.AddSystemMessage("Model " + m.agent.Model + " does not support images, switch to a vision model to paste images")
+		return false
+	}
+	image, err := llmServer.NewImageAttachment("clipboard.png", data)
+	if err != nil {
+		return false
+	}
+	m.Attachments = append(m.Attachments, *image)
+	return true
+}
+
+// GetClipboardImage returns PNG data from the system clipboard, or nil if it holds no image
+func (m *Model) GetClipboardImage() []byte {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// needs `brew install pngpaste`
+		cmd = exec.Command("pngpaste", "-")
+	case "linux":
+		cmd = exec.Command("xclip", "-selection", "clipboard", "-t", "image/png", "-o")
+	case "windows":
+		cmd = exec.Command("powershell", "-command",
+			"Add-Type -AssemblyName System.Windows.Forms; $i = [Windows.Forms.Clipboard]::GetImage(); "+
+				"if ($i) { $s = New-Object IO.MemoryStream; $i.Save($s, [Drawing.Imaging.ImageFormat]::Png); [Convert]::ToBase64String($s.ToArray()) }")
+	default:
+		return nil
+	}
+
+	output, err := cmd.Output()
+	if err != nil || len(output) == 0 {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		output, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+		if err != nil {
+			return nil
+		}
+	}
+	return output
+}
+
+// RemoveLastAttachment drops the most recently attached image
+func (m *Model) RemoveLastAttachment() {
+	if len(m.Attachments) > 0 {
+		m.Attachments = m.Attachments[:len(m.Attachments)-1]
+	}
+}
+
+// attachmentLabel is the text shown for attachments in chips and the transcript
+func attachmentLabel(images []llmServer.ImageAttachment) string {
+	labels := make([]string, 0, len(images))
+	for _, image := range images {
+		labels = append(labels, "📎 "+image.Name)
+	}
+	return strings.Join(labels, "  ")
+}
+
+// renderAttachmentChips renders one chip per pending attachment for the input box
+func (m *Model) renderAttachmentChips() string {
+	chips := make([]string, 0, len(m.Attachments))
+	for _, image := range m.Attachments {
+		chips = append(chips, AttachmentChipStyle.Render("📎 "+image.Name))
+	}
+	return strings.Join(chips, " ")
+}
@@ -0,0 +1,187 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/llmServer"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	zone "github.com/lrstanley/bubblezone"
+	"github.com/mattn/go-runewidth"
+)
+
+// Branch is a conversation abandoned by editing an earlier message, kept so it can be switched back to
+type Branch struct {
+	// Label is the user message the branch diverged at
+	Label    string
+	Messages []Message
+	History  llmServer.History
+	Created  time.Time
+}
+
+// messageZone is the bubblezone ID of the first line of message i in the chat
+func messageZone(i int) string {
+	return fmt.Sprintf("message-%d", i)
+}
+
+// EditMessage loads user message i into the input box; sending it rewinds the conversation to that point
+func (m *Model) EditMessage(i int) {
+	if m.IsThinking {
+		m.AddSystemMessage("Wait for the agent to finish before editing a message")
+		return
+	}
+	if i < 0 || i >= len(m.Messages) || m.Messages[i].Kind != KindUser || m.Messages[i].HistoryIndex < 1 {
+		m.AddSystemMessage("That message can't be edited")
+		return
+	}
+	m.IsEditingMessage = true
+	m.EditingMessageIndex = i
+	m.ClearState()
+	m.Attachments = nil
+	for _, char := range m.Messages[i].Input {
+		if char == '\n' {
+			m.InsertNewLine()
+		} else {
+			m.InsertCharacter(string(char))
+		}
+	}
+	m.UpdateWindowStart(m.GetMaxInputWidth())
+}
+
+// CancelEdit leaves edit mode without changing the conversation
+func (m *Model) CancelEdit() {
+	m.IsEditingMessage = false
+	m.EditingMessageIndex = 0
+	m.ClearState()
+}
+
+// rewindToEditedMessage saves the current conversation as a branch and cuts the transcript and
+// the agent history back to just before the message being edited
+func (m *Model) rewindToEditedMessage() error {
+	i := m.EditingMessageIndex
+	m.IsEditingMessage = false
+	m.EditingMessageIndex = 0
+	if i >= len(m.Messages) {
+		return fmt.Errorf("the message being edited is gone")
+	}
+
+	history, err := m.agent.Rewind(m.Messages[i].HistoryIndex)
+	if err != nil {
+		return err
+	}
+	m.Branches = append(m.Branches, Branch{
+		Label:    m.Messages[i].Input,
+		Messages: append([]Message{}, m.Messages...),
+		History:  history,
+		Created:  time.Now(),
+	})
+	m.Messages = m.Messages[:i]
+	m.PendingCommand = nil
+	m.PendingFunctionCall = nil
+	m.PendingQuestion = nil
+	m.AwaitingCommandApproval = false
+	return nil
+}
+
+// SwitchBranch swaps the current conversation with branch i, so the current one becomes a branch
+func (m *Model) SwitchBranch(i int) error {
+	if m.IsThinking {
+		return fmt.Errorf("wait for the agent to finish before switching branches")
+	}
+	if i < 0 || i >= len(m.Branches) {
+		return fmt.Errorf("no branch %d, see /branches", i+1)
+	}
+	branch := m.Branches[i]
+	m.Branches[i] = Branch{
+		Label:    branchLabel(m.Messages, branch.Messages),
+		Messages: m.Messages,
+		History:  m.agent.History(),
+		Created:  time.Now(),
+	}
+	m.agent.RestoreHistory(branch.History)
+	m.Messages = append([]Message{}, branch.Messages...)
+	m.Scroll = 0
+	m.PendingCommand = nil
+	m.PendingFunctionCall = nil
+	m.PendingQuestion = nil
+	m.AwaitingCommandApproval = false
+	return nil
+}
+
+// branchLabel names a conversation by its first user message that differs from other
+func branchLabel(messages []Message, other []Message) string {
+	for i, msg := range messages {
+		if msg.Kind != KindUser {
+			continue
+		}
+		if i >= len(other) || other[i].Input != msg.Input || other[i].Kind != msg.Kind {
+			return msg.Input
+		}
+	}
+	return "(no new messages)"
+}
+
+// HandleMessageClick starts editing the clicked user message
+func (m *Model) HandleMessageClick(msg tea.MouseMsg) bool {
+	for i, message := range m.Messages {
+		if message.Kind == KindUser && zone.Get(messageZone(i)).InBounds(msg) {
+			m.EditMessage(i)
+			return true
+		}
+	}
+	return false
+}
+
+// /rewind [n]
+func (m *Model) rewindCommand(args string) tea.Cmd {
+	n := 1
+	if args != "" {
+		if _, err := fmt.Sscanf(args, "%d", &n); err != nil || n < 1 {
+			m.AddSystemMessage("Usage: /rewind [n], where n counts user messages back from the latest")
+			return nil
+		}
+	}
+	for i := len(m.Messages) - 1; i >= 0; i-- {
+		if m.Messages[i].Kind != KindUser {
+			continue
+		}
+		if n--; n == 0 {
+			m.EditMessage(i)
+			return nil
+		}
+	}
+	m.AddSystemMessage("There aren't that many messages to rewind")
+	return nil
+}
+
+// /branches
+func (m *Model) branchesCommand(args string) tea.Cmd {
+	if len(m.Branches) == 0 {
+		m.AddSystemMessage("No branches yet. Edit an earlier message (click it or use /rewind) to start one.")
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString("Branches (switch with /branch <n>):")
+	for i, branch := range m.Branches {
+		label := runewidth.Truncate(strings.ReplaceAll(branch.Label, "\n", " "), 50, "…")
+		sb.WriteString(fmt.Sprintf("\n  %d. %s  (%d messages, %s)", i+1, label, len(branch.Messages), branch.Created.Format("15:04")))
+	}
+	m.AddSystemMessage(sb.String())
+	return nil
+}
+
+// /branch <n>
+func (m *Model) branchCommand(args string) tea.Cmd {
+	var n int
+	if _, err := fmt.Sscanf(args, "%d", &n); err != nil {
+		m.AddSystemMessage("Usage: /branch <n>, see /branches")
+		return nil
+	}
+	if err := m.SwitchBranch(n - 1); err != nil {
+		m.AddErrorMessage(err)
+		return nil
+	}
+	m.AddSystemMessage(fmt.Sprintf("Switched to branch %d, the previous conversation is now branch %d", n, n))
+	return nil
+}
@@ -0,0 +1,239 @@
+package ui
+
+import (
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// chatZone is the bubblezone ID of the chat box
+const chatZone = "chat"
+
+// doubleClickInterval is how quickly a second click must follow the first to select a whole message
+const doubleClickInterval = 400 * time.Millisecond
+
+// ChatSelection is text selected in the chat pane, in rendered line and cell coordinates.
+//
+// Lines are indexes into renderChatLines, so the selection survives scrolling.
+type ChatSelection struct {
+	// Active is true once something is selected
+	Active bool
+	// Dragging is true while the left button is held
+	Dragging  bool
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	// Message is the message selected by a double-click, -1 for a drag selection
+	Message int
+}
+
+// ordered returns the selection with its start before its end
+func (s ChatSelection) ordered() (startLine, startCol, endLine, endCol int) {
+	if s.StartLine > s.EndLine || (s.StartLine == s.EndLine && s.StartCol > s.EndCol) {
+		return s.EndLine, s.EndCol, s.StartLine, s.StartCol
+	}
+	return s.StartLine, s.StartCol, s.EndLine, s.EndCol
+}
+
+// chatLayout returns the rendered transcript, the first visible line and how many lines fit
+func (m *Model) chatLayout() (lines []chatLine, start int, visible int) {
+	termWidth, termHeight := m.Width, m.Height
+	if termWidth == 0 || termHeight == 0 {
+		termWidth = 80
+		termHeight = 20
+	}
+	wrapWidth := m.mainWidth(termWidth) - 2
+	if wrapWidth < 1 {
+		wrapWidth = 1
+	}
+	visible = termHeight - 7
+	if visible < 0 {
+		visible = 0
+	}
+	lines = m.renderChatLines(wrapWidth)
+	start, _ = chatWindow(len(lines), visible, m.Scroll)
+	return lines, start, visible
+}
+
+// chatPosition maps a mouse position to a transcript line and cell.
+//
+// With clamp, positions outside the chat text snap to its edges, as they do while dragging.
+func (m *Model) chatPosition(msg tea.MouseMsg, clamp bool) (line int, col int, ok bool) {
+	z := zone.Get(chatZone)
+	if z == nil || z.IsZero() || (!clamp && !z.InBounds(msg)) {
+		return 0, 0, false
+	}
+	lines, start, visible := m.chatLayout()
+	if len(lines) == 0 {
+		return 0, 0, false
+	}
+
+	// Skip the chat box border and padding
+	x, y := z.Pos(msg)
+	row, col := y-2, x-2
+	if !clamp && (row < 0 || row >= visible || start+row >= len(lines) || col < 0) {
+		return 0, 0, false
+	}
+	line = start + row
+	if line < start {
+		line, col = start, 0
+	}
+	if line >= len(lines) {
+		line, col = len(lines)-1, ansi.StringWidth(lines[len(lines)-1].Rendered)
+	}
+	if col < 0 {
+		col = 0
+	}
+	return line, col, true
+}
+
+// HandleChatMouse drives selection in the chat pane with the left button.
+//
+// Returns true if a release ended a selection, so it isn't also treated as a click.
+func (m *Model) HandleChatMouse(msg tea.MouseMsg) bool {
+	switch msg.Action {
+	case tea.MouseActionPress:
+		line, col, ok := m.chatPosition(msg, false)
+		if !ok {
+			m.ClearChatSelection()
+			return false
+		}
+		lines, _, _ := m.chatLayout()
+		message := lines[line].Message
+		if time.Since(m.lastChatClick) < doubleClickInterval && m.lastChatClickMessage == message {
+			m.lastChatClick = time.Time{}
+			m.SelectChatMessage(message)
+			return false
+		}
+		m.lastChatClick = time.Now()
+		m.lastChatClickMessage = message
+		m.ChatSelection = ChatSelection{Dragging: true, StartLine: line, StartCol: col, EndLine: line, EndCol: col, Message: -1}
+
+	case tea.MouseActionMotion:
+		if !m.ChatSelection.Dragging {
+			return false
+		}
+		line, col, ok := m.chatPosition(msg, true)
+		if !ok {
+			return false
+		}
+		m.ChatSelection.EndLine = line
+		m.ChatSelection.EndCol = col
+		m.ChatSelection.Active = line != m.ChatSelection.StartLine || col != m.ChatSelection.StartCol
+
+	case tea.MouseActionRelease:
+		m.ChatSelection.Dragging = false
+		return m.ChatSelection.Active
+	}
+	return false
+}
+
+// SelectChatMessage selects every line of message i
+func (m *Model) SelectChatMessage(i int) {
+	// The first click of a double-click on a user message started editing it
+	if m.IsEditingMessage && m.EditingMessageIndex == i {
+		m.CancelEdit()
+	}
+	lines, _, _ := m.chatLayout()
+	first, last := -1, -1
+	for y, line := range lines {
+		if line.Message == i {
+			if first < 0 {
+				first = y
+			}
+			last = y
+		}
+	}
+	if first < 0 {
+		return
+	}
+	m.ChatSelection = ChatSelection{
+		Active:    true,
+		StartLine: first,
+		EndLine:   last,
+		EndCol:    ansi.StringWidth(lines[last].Rendered),
+		Message:   i,
+	}
+}
+
+// ClearChatSelection drops the chat selection
+func (m *Model) ClearChatSelection() {
+	m.ChatSelection = ChatSelection{Message: -1}
+}
+
+// chatSelectionColumns returns the selected cells [left, right) of line y, ok false if none are selected
+func (m Model) chatSelectionColumns(y int, line chatLine) (left int, right int, ok bool) {
+	if !m.ChatSelection.Active {
+		return 0, 0, false
+	}
+	startLine, startCol, endLine, endCol := m.ChatSelection.ordered()
+	if y < startLine || y > endLine {
+		return 0, 0, false
+	}
+	width := ansi.StringWidth(line.Rendered)
+	left, right = 0, width
+	if y == startLine {
+		left = startCol
+	}
+	if y == endLine {
+		right = endCol + 1
+	}
+	// The sender prefix is decoration, not content
+	if left < line.Indent {
+		left = line.Indent
+	}
+	if right > width {
+		right = width
+	}
+	return left, right, left < right
+}
+
+// highlightChatLine renders transcript line y with search matches marked and the selected part in reverse video
+func (m Model) highlightChatLine(y int, line chatLine) string {
+	rendered := m.highlightSearchMatches(y, line)
+	left, right, ok := m.chatSelectionColumns(y, line)
+	if !ok {
+		return rendered
+	}
+	width := ansi.StringWidth(rendered)
+	return ansi.Cut(rendered, 0, left) +
+		SelectionStyle.Render(ansi.Strip(ansi.Cut(rendered, left, right))) +
+		ansi.Cut(rendered, right, width)
+}
+
+// SelectedChatText returns the text selected in the chat pane.
+//
+// A double-clicked message copies its original content, so markdown and code survive intact.
+func (m *Model) SelectedChatText() string {
+	if !m.ChatSelection.Active {
+		return ""
+	}
+	if i := m.ChatSelection.Message; i >= 0 && i < len(m.Messages) {
+		return m.Messages[i].Content
+	}
+
+	lines, _, _ := m.chatLayout()
+	startLine, _, endLine, _ := m.ChatSelection.ordered()
+	var sb strings.Builder
+	for y := startLine; y <= endLine && y < len(lines); y++ {
+		left, right, ok := m.chatSelectionColumns(y, lines[y])
+		text := ""
+		if ok {
+			text = strings.TrimRight(ansi.Strip(ansi.Cut(lines[y].Rendered, left, right)), " ")
+		}
+		if y > startLine {
+			// Undo word wrapping, a different message or source line is a new line
+			if lines[y].WrappedAtSpace {
+				sb.WriteString(" ")
+			} else if !lines[y].SoftWrap {
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString(text)
+	}
+	return sb.String()
+}
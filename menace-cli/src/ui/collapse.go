@@ -0,0 +1,101 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// CollapseThreshold is the number of lines above which outputs are shown collapsed
+const CollapseThreshold = 15
+
+// Lines of a collapsed output shown before and after the hidden part
+const (
+	collapsedHead = 5
+	collapsedTail = 3
+)
+
+// Collapsible reports whether the message is an output long enough to be collapsed.
+//
+// Only the display is shortened, Content keeps the full text for copying and export.
+func (msg Message) Collapsible() bool {
+	switch msg.Kind {
+	case KindOutput, KindDiff, KindError:
+		return strings.Count(msg.Content, "\n")+1 > CollapseThreshold
+	}
+	return false
+}
+
+// toggleZone is the bubblezone ID of the expand/collapse line of message i
+func toggleZone(i int) string {
+	return fmt.Sprintf("toggle-%d", i)
+}
+
+// toggleHint is how to expand or collapse an output, e.g. "click or Ctrl+O"
+func (k *Keymap) toggleHint() string {
+	if !k.Bound(ActionToggleOutput) {
+		return "click"
+	}
+	return "click or " + k.ShortHelp(ActionToggleOutput)
+}
+
+// collapseParts returns the lines to show for a collapsible message and the index of the toggle line.
+//
+// hint says how to toggle, see toggleHint.
+func collapseParts(lines []string, expanded bool, hint string) ([]string, int) {
+	if expanded {
+		return append(append([]string{}, lines...), "▴ collapse ("+hint+")"), len(lines)
+	}
+	hidden := len(lines) - collapsedHead - collapsedTail
+	parts := append([]string{}, lines[:collapsedHead]...)
+	parts = append(parts, fmt.Sprintf("▾ %d more lines, %d total (%s to expand)", hidden, len(lines), hint))
+	parts = append(parts, lines[len(lines)-collapsedTail:]...)
+	return parts, collapsedHead
+}
+
+// ToggleCollapse expands or collapses message i, keeping the top of the view in place
+func (m *Model) ToggleCollapse(i int) {
+	if i < 0 || i >= len(m.Messages) || !m.Messages[i].Collapsible() {
+		return
+	}
+	message, offset, anchored := m.anchorScroll()
+	m.Messages[i].Expanded = !m.Messages[i].Expanded
+	if anchored {
+		m.restoreScroll(message, offset)
+	}
+	// Line numbers below the message moved
+	m.ClearChatSelection()
+	m.Search.Current = searchMatch{Line: -1}
+}
+
+// HandleCollapseClick toggles the output whose expand/collapse line was clicked
+func (m *Model) HandleCollapseClick(msg tea.MouseMsg) bool {
+	for i, message := range m.Messages {
+		if message.Collapsible() && zone.Get(toggleZone(i)).InBounds(msg) {
+			m.ToggleCollapse(i)
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleLatestCollapse toggles the newest collapsible output that is on screen, or the newest
+// one overall if none is visible. Returns false if there is nothing to toggle.
+func (m *Model) ToggleLatestCollapse() bool {
+	lines, start, visible := m.chatLayout()
+	for y := start + visible - 1; y >= start; y-- {
+		if y < len(lines) && m.Messages[lines[y].Message].Collapsible() {
+			m.ToggleCollapse(lines[y].Message)
+			return true
+		}
+	}
+	for i := len(m.Messages) - 1; i >= 0; i-- {
+		if m.Messages[i].Collapsible() {
+			m.ToggleCollapse(i)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,404 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/config"
+	"menace-go/llmServer"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-runewidth"
+)
+
+// SlashCommand is a command typed into the input box as "/name args".
+//
+// Slash commands are handled locally and never sent to the model.
+type SlashCommand struct {
+	Name        string
+	Usage       string // argument hint, e.g. "<path>"
+	Description string
+	// Idle commands change or send to the conversation, so they wait for the agent to finish
+	Idle bool
+	Run  func(m *Model, args string) tea.Cmd
+}
+
+// slashCommands is the registry of built-in commands, filled in init to avoid an initialization cycle
+var slashCommands []SlashCommand
+
+func init() {
+	slashCommands = []SlashCommand{
+		{Name: "help", Description: "Show key bindings, commands, agent tools and config files", Run: (*Model).helpCommand},
+		{Name: "clear", Description: "Clear the conversation, both on screen and in the agent's history", Idle: true, Run: (*Model).clearCommand},
+		{Name: "model", Usage: "[name]", Description: "Switch model, opens the model picker without arguments", Run: (*Model).modelCommand},
+		{Name: "save", Usage: "[path]", Description: "Save the transcript as markdown", Run: (*Model).saveCommand},
+		{Name: "undo", Description: "Revert the last file change made by the agent", Idle: true, Run: (*Model).undoCommand},
+		{Name: "cost", Description: "Show token usage and estimated cost of this session", Run: (*Model).costCommand},
+		{Name: "exit", Description: "Quit Menace", Run: (*Model).exitCommand},
+		{Name: "pin", Usage: "[path...]", Description: "Pin files so their current contents are sent every turn, lists pins without arguments", Run: (*Model).pinCommand},
+		{Name: "unpin", Usage: "[path...]", Description: "Unpin files, or all files without arguments", Run: (*Model).unpinCommand},
+		{Name: "memory", Description: "Show and delete what the agent remembers about you and this project", Run: (*Model).memoryCommand},
+		{Name: "persona", Usage: "[name]", Description: "Switch persona keeping the conversation, lists personas without arguments", Idle: true, Run: (*Model).personaCommand},
+		{Name: "init", Description: "Inspect the project and draft a " + llmServer.InstructionsFileName + " instructions file", Idle: true, Run: (*Model).initCommand},
+		{Name: "rewind", Usage: "[n]", Description: "Edit and resend your n-th latest message (default 1), keeping the rest as a branch", Idle: true, Run: (*Model).rewindCommand},
+		{Name: "branches", Description: "List conversations left behind by edited messages", Run: (*Model).branchesCommand},
+		{Name: "branch", Usage: "<n>", Description: "Switch to a branch from /branches", Idle: true, Run: (*Model).branchCommand},
+		{Name: "vim", Usage: "[on|off]", Description: "Toggle Vim keybindings for the input", Run: (*Model).vimCommand},
+		{Name: "settings", Description: "Open the settings page", Run: (*Model).settingsCommand},
+		{Name: "theme", Usage: "[name]", Description: "Switch color theme, lists themes without arguments", Run: (*Model).themeCommand},
+	}
+}
+
+// findSlashCommand looks up a built-in or custom command by name (without the "/")
+func findSlashCommand(name string) *SlashCommand {
+	commands := allSlashCommands()
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// findBuiltinSlashCommand looks up a built-in command by name (without the "/")
+func findBuiltinSlashCommand(name string) *SlashCommand {
+	for i := range slashCommands {
+		if slashCommands[i].Name == name {
+			return &slashCommands[i]
+		}
+	}
+	return nil
+}
+
+// parseSlashCommand splits "/name args" input, ok is false if input is a message
+func parseSlashCommand(input string) (name string, args string, ok bool) {
+	trimmed := strings.TrimSpace(input)
+	if !strings.HasPrefix(trimmed, "/") {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(strings.TrimPrefix(trimmed, "/"), " ")
+	// Something like "/usr/bin/env is broken" is a message, not a command
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", false
+	}
+	return name, args, true
+}
+
+// HandleSlashCommand runs input if it is a slash command.
+//
+// Returns the command's tea.Cmd and true if input was handled locally.
+func (m *Model) HandleSlashCommand(input string) (tea.Cmd, bool) {
+	name, args, ok := parseSlashCommand(input)
+	if !ok {
+		return nil, false
+	}
+
+	command := findSlashCommand(name)
+	if command != nil && command.Idle && m.IsThinking {
+		m.AddSystemMessage("Wait for the agent to finish before running /" + name)
+		return nil, true
+	}
+	m.ClearState()
+	if command == nil {
+		m.AddSystemMessage("Unknown command: /" + name)
+		return nil, true
+	}
+	return command.Run(m, strings.TrimSpace(args)), true
+}
+
+// slashCompletions returns the commands matching a partially typed "/name", for the popup.
+//
+// Returns nil once the user has typed a space (they are entering arguments) or for multi-line input.
+func slashCompletions(input string) []SlashCommand {
+	if !strings.HasPrefix(input, "/") || strings.ContainsAny(input, " \n") {
+		return nil
+	}
+	prefix := strings.TrimPrefix(input, "/")
+	var matches []SlashCommand
+	for _, command := range allSlashCommands() {
+		if strings.HasPrefix(command.Name, prefix) {
+			matches = append(matches, command)
+		}
+	}
+	return matches
+}
+
+// CommandPopupOpen reports whether the slash command popup is showing
+func (m *Model) CommandPopupOpen() bool {
+	return len(slashCompletions(m.Input)) > 0
+}
+
+// HandleCommandPopupNavigation moves the popup selection up or down
+func (m *Model) HandleCommandPopupNavigation(direction string) {
+	matches := slashCompletions(m.Input)
+	if direction == tea.KeyUp.String() && m.CommandPopupCursor > 0 {
+		m.CommandPopupCursor--
+	} else if direction == tea.KeyDown.String() && m.CommandPopupCursor < len(matches)-1 {
+		m.CommandPopupCursor++
+	}
+}
+
+// CompleteSlashCommand replaces the typed prefix with the command selected in the popup
+func (m *Model) CompleteSlashCommand() {
+	matches := slashCompletions(m.Input)
+	if len(matches) == 0 {
+		return
+	}
+	if m.CommandPopupCursor >= len(matches) {
+		m.CommandPopupCursor = len(matches) - 1
+	}
+	m.Input = "/" + matches[m.CommandPopupCursor].Name
+	m.CursorX = len([]rune(m.Input))
+	m.CursorY = 0
+	m.CommandPopupCursor = 0
+}
+
+// renderCommandPopup lists the matching commands with their descriptions
+func (m *Model) renderCommandPopup(width int) string {
+	matches := slashCompletions(m.Input)
+	lines := make([]string, 0, len(matches))
+	for i, command := range matches {
+		line := "/" + command.Name
+		if command.Usage != "" {
+			line += " " + command.Usage
+		}
+		line = runewidth.FillRight(line, 18) + " " + command.Description
+		line = runewidth.Truncate(line, width, "…")
+		if i == m.CommandPopupCursor {
+			lines = append(lines, CommandPopupSelectedStyle.Render(line))
+		} else {
+			lines = append(lines, CommandPopupStyle.Render(line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// /help
+func (m *Model) helpCommand(args string) tea.Cmd {
+	m.OpenHelp()
+	return nil
+}
+
+// /clear
+func (m *Model) clearCommand(args string) tea.Cmd {
+	m.agent.ClearHistory()
+	m.Messages = nil
+	m.Scroll = 0
+	m.PendingCommand = nil
+	m.PendingFunctionCall = nil
+	m.PendingQuestion = nil
+	m.AwaitingCommandApproval = false
+	return nil
+}
+
+// /model [name]
+func (m *Model) modelCommand(args string) tea.Cmd {
+	if args == "" {
+		return m.OpenConfig()
+	}
+	loadAvailableModels()
+	if name, ok := findModel(args); ok {
+		m.SwitchModel(name)
+		return nil
+	}
+	// It may be an Ollama model that isn't listed yet
+	return listOllamaModels(args)
+}
+
+// /save [path]
+func (m *Model) saveCommand(args string) tea.Cmd {
+	path := args
+	if path == "" {
+		path = "menace-transcript-" + time.Now().Format("20060102-150405") + ".md"
+	}
+	if err := m.SaveTranscript(path); err != nil {
+		m.AddErrorMessage(fmt.Errorf("saving transcript: %v", err))
+		return nil
+	}
+	m.AddSystemMessage("Transcript saved to " + path)
+	return nil
+}
+
+// /undo
+func (m *Model) undoCommand(args string) tea.Cmd {
+	if len(m.FileHistory) == 0 {
+		m.AddSystemMessage("Nothing to undo")
+		return nil
+	}
+	snapshot := m.FileHistory[len(m.FileHistory)-1]
+	if err := snapshot.Restore(); err != nil {
+		m.AddErrorMessage(fmt.Errorf("undoing change to %s: %v", snapshot.Path, err))
+		return nil
+	}
+	m.FileHistory = m.FileHistory[:len(m.FileHistory)-1]
+	m.AddSystemMessage("Reverted the last change to " + snapshot.Path)
+	// Let the model know its edit is gone so it doesn't build on it
+	m.agent.AddToMessageChain("The user reverted your last change to "+snapshot.Path+". Re-read the file before editing it again.", "")
+	return nil
+}
+
+// /cost
+func (m *Model) costCommand(args string) tea.Cmd {
+	usage := m.agent.Usage()
+	text := fmt.Sprintf("Requests: %d\nInput tokens: %d\nOutput tokens: %d\nEstimated cost: $%.4f",
+		usage.Requests, usage.InputTokens, usage.OutputTokens, usage.Cost)
+	if usage.UnpricedRequests > 0 {
+		text += fmt.Sprintf("\n(%d requests to models without a known price are not included)", usage.UnpricedRequests)
+	}
+	m.AddSystemMessage(text)
+	return nil
+}
+
+// /exit
+func (m *Model) exitCommand(args string) tea.Cmd {
+	return tea.Quit
+}
+
+// /vim [on|off]
+func (m *Model) vimCommand(args string) tea.Cmd {
+	enabled := !m.Vim.Enabled
+	switch strings.TrimSpace(args) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	case "":
+	default:
+		m.AddSystemMessage("Usage: /vim [on|off]")
+		return nil
+	}
+	m.SetVimMode(enabled)
+	if enabled {
+		m.AddSystemMessage("Vim mode on: Esc for normal mode, i to insert. Set \"editor_mode\": \"vim\" in " + config.UserFile() + " to keep it on")
+	} else {
+		m.AddSystemMessage("Vim mode off")
+	}
+	return nil
+}
+
+// /settings
+func (m *Model) settingsCommand(args string) tea.Cmd {
+	cmd := m.OpenConfig()
+	// Start past the model picker, /model opens that
+	m.Settings.Tab = 1
+	return cmd
+}
+
+// /theme [name]
+func (m *Model) themeCommand(args string) tea.Cmd {
+	if args == "" {
+		var sb strings.Builder
+		sb.WriteString("Themes:")
+		for _, name := range ThemeNames(m.themes) {
+			marker := "  "
+			if name == m.theme {
+				marker = "* "
+			}
+			sb.WriteString("\n" + marker + name)
+		}
+		m.AddSystemMessage(sb.String())
+		return nil
+	}
+	if err := m.SetTheme(args); err != nil {
+		m.AddErrorMessage(fmt.Errorf("switching theme: %v", err))
+		return nil
+	}
+	m.AddSystemMessage("Switched to theme " + args + ". Set \"theme\": \"" + args + "\" in " + config.UserFile() + " to keep it")
+	return nil
+}
+
+// /pin [path...]
+func (m *Model) pinCommand(args string) tea.Cmd {
+	if args == "" {
+		pinned := m.agent.PinnedFiles()
+		if len(pinned) == 0 {
+			m.AddSystemMessage("No pinned files. Use /pin <path> to pin one.")
+		} else {
+			m.AddSystemMessage("Pinned files:\n" + strings.Join(pinned, "\n"))
+		}
+		return nil
+	}
+	for _, path := range strings.Fields(args) {
+		pinned, err := m.agent.PinFile(strings.TrimPrefix(path, "@"))
+		if err != nil {
+			m.AddSystemMessage("Could not pin " + path + ": " + err.Error())
+			continue
+		}
+		m.AddSystemMessage("Pinned " + pinned + ", its current contents will be sent with every message")
+	}
+	return nil
+}
+
+// /unpin [path...]
+func (m *Model) unpinCommand(args string) tea.Cmd {
+	if args == "" {
+		m.agent.UnpinAll()
+		m.AddSystemMessage("Unpinned all files")
+		return nil
+	}
+	for _, path := range strings.Fields(args) {
+		if m.agent.UnpinFile(strings.TrimPrefix(path, "@")) {
+			m.AddSystemMessage("Unpinned " + path)
+		} else {
+			m.AddSystemMessage(path + " is not pinned")
+		}
+	}
+	return nil
+}
+
+// /memory
+func (m *Model) memoryCommand(args string) tea.Cmd {
+	m.OpenMemory()
+	return nil
+}
+
+// /persona [name]
+func (m *Model) personaCommand(args string) tea.Cmd {
+	if args == "" {
+		current := m.agent.Persona()
+		var sb strings.Builder
+		sb.WriteString("Personas:")
+		for _, name := range m.agent.Personas() {
+			persona, _ := m.agent.PersonaInfo(name)
+			marker := "  "
+			if name == current {
+				marker = "* "
+			}
+			sb.WriteString("\n" + marker + name)
+			if persona.Description != "" {
+				sb.WriteString(" - " + persona.Description)
+			}
+		}
+		m.AddSystemMessage(sb.String())
+		return nil
+	}
+	if err := m.agent.SetPersona(args); err != nil {
+		m.AddErrorMessage(fmt.Errorf("switching persona: %v", err))
+		return nil
+	}
+	m.AddSystemMessage("Switched to persona " + args + " (model " + m.agent.Model + ")")
+	return nil
+}
+
+// Prompt sent by /init, %s is the instructions file name, the second %s says whether it exists
+const initPrompt = `Create a %s file in the current working directory with instructions for working on this project.
+%s
+First inspect the project one command at a time: list the files, then read the README, build files (Makefile, package.json, go.mod, pyproject.toml, Cargo.toml and similar), CI configuration and any contributing guide.
+Then write the file with CreateAndApplyDiffs. Keep it short and specific to this project, covering:
+- how to build, run, lint and test (exact commands)
+- code style and naming conventions actually used in the code
+- directories and files that must not be edited (generated code, vendored dependencies, build output)
+- commit message and branch conventions, if the history shows any
+Do not invent rules you did not see evidence for.`
+
+// /init
+func (m *Model) initCommand(args string) tea.Cmd {
+	existing := "There is no such file yet."
+	if _, err := os.Stat(llmServer.InstructionsFileName); err == nil {
+		existing = "The file already exists. Read it first and only add or correct what is missing or wrong, keeping the existing content otherwise."
+	}
+	// /init is a new task, not part of a custom command's
+	m.agent.ClearOverride()
+	return m.SendToAgent("/init", fmt.Sprintf(initPrompt, llmServer.InstructionsFileName, existing))
+}
@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/config"
+	"menace-go/llmServer"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// CommandsDirName is the directory of custom command files in the user config dir and .menace
+const CommandsDirName = "commands"
+
+// ArgumentsPlaceholder is replaced by whatever the user typed after the command name
+const ArgumentsPlaceholder = "$ARGUMENTS"
+
+// CustomCommand is a prompt template loaded from a markdown file
+type CustomCommand struct {
+	Name        string
+	Path        string
+	Description string
+	Provider    string
+	Model       string
+	Tools       []string
+	Prompt      string
+}
+
+// customCommands are loaded from disk by LoadCustomCommands
+var customCommands []SlashCommand
+
+// allSlashCommands returns the built-in commands followed by the custom ones
+func allSlashCommands() []SlashCommand {
+	return append(append([]SlashCommand{}, slashCommands...), customCommands...)
+}
+
+// LoadCustomCommands reads custom commands from the user config dir and the project's .menace dir.
+//
+// Each *.md file becomes "/<file name>". Project commands replace user commands of the same name,
+// built-in commands can't be replaced. Returns one error per file that couldn't be loaded.
+func LoadCustomCommands() []error {
+	var errs []error
+	byName := map[string]CustomCommand{}
+	for _, dir := range []string{
+		filepath.Join(config.UserDir(), CommandsDirName),
+		filepath.Join(config.ProjectDir(), CommandsDirName),
+	} {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, path := range paths {
+			command, err := parseCustomCommand(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if findBuiltinSlashCommand(command.Name) != nil {
+				errs = append(errs, fmt.Errorf("%s: /%s is a built-in command", path, command.Name))
+				continue
+			}
+			byName[command.Name] = command
+		}
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	customCommands = nil
+	for _, name := range names {
+		command := byName[name]
+		description := command.Description
+		if description == "" {
+			description = "Custom command from " + command.Path
+		}
+		customCommands = append(customCommands, SlashCommand{
+			Name:        command.Name,
+			Usage:       "[arguments]",
+			Description: description,
+			Idle:        true,
+			Run: func(m *Model, args string) tea.Cmd {
+				return m.runCustomCommand(command, args)
+			},
+		})
+	}
+	return errs
+}
+
+// parseCustomCommand reads a command file with optional front-matter:
+//
+//	---
+//	description: Review the diff for concurrency bugs
+//	model: gpt-4o
+//	provider: openai
+//	tools: shell, ReadFileWithLineNumbers
+//	---
+//	Review $ARGUMENTS ...
+func parseCustomCommand(path string) (CustomCommand, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CustomCommand{}, err
+	}
+	command := CustomCommand{
+		Name: strings.ToLower(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))),
+		Path: path,
+	}
+	if strings.ContainsAny(command.Name, " /") {
+		return CustomCommand{}, fmt.Errorf("%s: command names can't contain spaces or slashes", path)
+	}
+
+	body := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if strings.HasPrefix(body, "---\n") {
+		// Cut on "\n---" so an empty front-matter block still has a newline before its closing line
+		frontMatter, rest, found := strings.Cut(body[len("---"):], "\n---")
+		if !found {
+			return CustomCommand{}, fmt.Errorf("%s: front-matter is missing its closing ---", path)
+		}
+		body = strings.TrimPrefix(rest, "\n")
+		for i, line := range strings.Split(frontMatter, "\n") {
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				return CustomCommand{}, fmt.Errorf("%s:%d: expected key: value", path, i+1)
+			}
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "description":
+				command.Description = value
+			case "model":
+				command.Model = value
+			case "provider":
+				command.Provider = value
+			case "tools", "allowed-tools", "allowed_tools":
+				for _, tool := range strings.Split(strings.Trim(value, "[]"), ",") {
+					if tool = strings.Trim(strings.TrimSpace(tool), `"'`); tool != "" {
+						command.Tools = append(command.Tools, tool)
+					}
+				}
+			default:
+				return CustomCommand{}, fmt.Errorf("%s:%d: unknown front-matter key %q", path, i+1, strings.TrimSpace(key))
+			}
+		}
+	}
+
+	command.Prompt = strings.TrimSpace(body)
+	if command.Prompt == "" {
+		return CustomCommand{}, fmt.Errorf("%s: prompt is empty", path)
+	}
+	for _, tool := range command.Tools {
+		if tool != llmServer.ShellTool && !llmServer.IsAvailableFunction(tool) {
+			return CustomCommand{}, fmt.Errorf("%s: unknown tool %q", path, tool)
+		}
+	}
+	return command, nil
+}
+
+// runCustomCommand expands the prompt and sends it, applying the command's model and tools
+// until the user sends their next message.
+func (m *Model) runCustomCommand(command CustomCommand, args string) tea.Cmd {
+	// A previous command's override must not carry over to this one
+	m.agent.ClearOverride()
+
+	prompt := command.Prompt
+	if strings.Contains(prompt, ArgumentsPlaceholder) {
+		prompt = strings.ReplaceAll(prompt, ArgumentsPlaceholder, args)
+	} else if args != "" {
+		prompt += "\n\n" + args
+	}
+
+	if command.Model != "" || len(command.Tools) > 0 {
+		err := m.agent.SetOverride(llmServer.TaskOverride{
+			Provider: command.Provider,
+			Model:    command.Model,
+			Tools:    command.Tools,
+		})
+		if err != nil {
+			m.AddErrorMessage(fmt.Errorf("running /%s: %v", command.Name, err))
+			return nil
+		}
+		if len(command.Tools) > 0 {
+			prompt += "\n\nFor this task you may only use these tools: " + strings.Join(command.Tools, ", ") + "."
+		}
+	}
+
+	shown := "/" + command.Name
+	if args != "" {
+		shown += " " + args
+	}
+	return m.SendToAgent(shown, prompt)
+}
@@ -0,0 +1,310 @@
+package ui
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxUndo bounds the undo stack, the oldest entries are dropped first
+const maxUndo = 200
+
+// editorState is a snapshot of the input for undo and redo
+type editorState struct {
+	Input   string
+	CursorX int
+	CursorY int
+}
+
+// snapshot returns the current input state
+func (m *Model) snapshot() editorState {
+	return editorState{Input: m.Input, CursorX: m.CursorX, CursorY: m.CursorY}
+}
+
+// restore puts the input back to a snapshot
+func (m *Model) restore(state editorState) {
+	m.Input = state.Input
+	m.CursorX = state.CursorX
+	m.CursorY = state.CursorY
+	m.ClearInputSelection()
+}
+
+// RecordEdit pushes the state before a keypress onto the undo stack if the keypress changed the input.
+//
+// A run of typed characters is undone as one step, up to and including the space that ends a word.
+func (m *Model) RecordEdit(before editorState, typing bool) {
+	if m.Input == before.Input {
+		m.lastEditTyping = false
+		return
+	}
+	if !typing || !m.lastEditTyping || len(m.undoStack) == 0 {
+		m.undoStack = append(m.undoStack, before)
+		if len(m.undoStack) > maxUndo {
+			m.undoStack = m.undoStack[1:]
+		}
+	}
+	m.redoStack = nil
+	m.lastEditTyping = typing && !unicode.IsSpace(lastTyped(m.Input, m.CursorX, m.CursorY))
+}
+
+// lastTyped returns the rune before the cursor, 0 at the start of a line
+func lastTyped(input string, x int, y int) rune {
+	lines := strings.Split(input, "\n")
+	if y >= len(lines) {
+		return 0
+	}
+	runes := []rune(lines[y])
+	if x <= 0 || x > len(runes) {
+		return 0
+	}
+	return runes[x-1]
+}
+
+// Undo reverts the last edit to the input
+func (m *Model) Undo() {
+	if len(m.undoStack) == 0 {
+		return
+	}
+	state := m.undoStack[len(m.undoStack)-1]
+	m.undoStack = m.undoStack[:len(m.undoStack)-1]
+	m.redoStack = append(m.redoStack, m.snapshot())
+	m.restore(state)
+	m.lastEditTyping = false
+}
+
+// Redo reapplies the last undone edit
+func (m *Model) Redo() {
+	if len(m.redoStack) == 0 {
+		return
+	}
+	state := m.redoStack[len(m.redoStack)-1]
+	m.redoStack = m.redoStack[:len(m.redoStack)-1]
+	m.undoStack = append(m.undoStack, m.snapshot())
+	m.restore(state)
+	m.lastEditTyping = false
+}
+
+// inputOffset converts a cursor position to a rune offset into the whole input
+func inputOffset(lines []string, x int, y int) int {
+	offset := 0
+	for i := 0; i < y && i < len(lines); i++ {
+		offset += len([]rune(lines[i])) + 1
+	}
+	return offset + x
+}
+
+// deleteRange removes the input between two cursor positions, which may span lines, and leaves the cursor at the first
+func (m *Model) deleteRange(x1, y1, x2, y2 int) {
+	if y1 > y2 || (y1 == y2 && x1 > x2) {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+	lines := strings.Split(m.Input, "\n")
+	runes := []rune(m.Input)
+	start := inputOffset(lines, x1, y1)
+	end := inputOffset(lines, x2, y2)
+	if end > len(runes) {
+		end = len(runes)
+	}
+	if start < end {
+		m.Input = string(runes[:start]) + string(runes[end:])
+	}
+	m.CursorX = x1
+	m.CursorY = y1
+}
+
+// inputSelection returns the selected range of the input with its start before its end.
+//
+// SelectionStart is where the selection was started and SelectionEnd follows the cursor, so either may come first.
+func (m *Model) inputSelection() (startX, startY, endX, endY int) {
+	startX, startY, endX, endY = m.SelectionStartX, m.SelectionStartY, m.SelectionEndX, m.SelectionEndY
+	if startY > endY || (startY == endY && startX > endX) {
+		return endX, endY, startX, startY
+	}
+	return startX, startY, endX, endY
+}
+
+// ClearInputSelection drops the input selection
+func (m *Model) ClearInputSelection() {
+	m.IsHighlighting = false
+	m.SelectionStartX = 0
+	m.SelectionStartY = 0
+	m.SelectionEndX = 0
+	m.SelectionEndY = 0
+}
+
+// DeleteSelection removes the selected text, returns false if nothing was selected
+func (m *Model) DeleteSelection() bool {
+	if !m.IsHighlighting {
+		return false
+	}
+	startX, startY, endX, endY := m.inputSelection()
+	m.deleteRange(startX, startY, endX, endY)
+	m.ClearInputSelection()
+	return true
+}
+
+// isWordRune is true for the letters, digits and underscores that make up a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// wordLeft returns the start of the word before column x: spaces are skipped, then a run of
+// word characters or of punctuation
+func wordLeft(runes []rune, x int) int {
+	for x > 0 && unicode.IsSpace(runes[x-1]) {
+		x--
+	}
+	if x > 0 {
+		word := isWordRune(runes[x-1])
+		for x > 0 && !unicode.IsSpace(runes[x-1]) && isWordRune(runes[x-1]) == word {
+			x--
+		}
+	}
+	return x
+}
+
+// wordRight returns the end of the word after column x, the mirror of wordLeft
+func wordRight(runes []rune, x int) int {
+	for x < len(runes) && unicode.IsSpace(runes[x]) {
+		x++
+	}
+	if x < len(runes) {
+		word := isWordRune(runes[x])
+		for x < len(runes) && !unicode.IsSpace(runes[x]) && isWordRune(runes[x]) == word {
+			x++
+		}
+	}
+	return x
+}
+
+// wordLeftPosition is where Ctrl+Left moves the cursor, the end of the previous line from the start of a line
+func (m *Model) wordLeftPosition() (int, int) {
+	lines := strings.Split(m.Input, "\n")
+	if m.CursorX == 0 {
+		if m.CursorY == 0 {
+			return 0, 0
+		}
+		return len([]rune(lines[m.CursorY-1])), m.CursorY - 1
+	}
+	return wordLeft([]rune(lines[m.CursorY]), m.CursorX), m.CursorY
+}
+
+// wordRightPosition is where Ctrl+Right moves the cursor, the start of the next line from the end of a line
+func (m *Model) wordRightPosition() (int, int) {
+	lines := strings.Split(m.Input, "\n")
+	runes := []rune(lines[m.CursorY])
+	if m.CursorX >= len(runes) {
+		if m.CursorY >= len(lines)-1 {
+			return len(runes), m.CursorY
+		}
+		return 0, m.CursorY + 1
+	}
+	return wordRight(runes, m.CursorX), m.CursorY
+}
+
+// MoveWordLeft moves the cursor to the start of the previous word
+func (m *Model) MoveWordLeft() {
+	m.CursorX, m.CursorY = m.wordLeftPosition()
+}
+
+// MoveWordRight moves the cursor to the end of the next word
+func (m *Model) MoveWordRight() {
+	m.CursorX, m.CursorY = m.wordRightPosition()
+}
+
+// MoveToLineStart moves the cursor to the start of its line
+func (m *Model) MoveToLineStart() {
+	m.CursorX = 0
+}
+
+// MoveToLineEnd moves the cursor to the end of its line
+func (m *Model) MoveToLineEnd() {
+	lines := strings.Split(m.Input, "\n")
+	m.CursorX = len([]rune(lines[m.CursorY]))
+}
+
+// DeleteWordBackward deletes from the start of the previous word to the cursor (Ctrl+W)
+func (m *Model) DeleteWordBackward() {
+	if m.DeleteSelection() {
+		return
+	}
+	x, y := m.wordLeftPosition()
+	m.deleteRange(x, y, m.CursorX, m.CursorY)
+}
+
+// DeleteWordForward deletes from the cursor to the end of the next word (Alt+D)
+func (m *Model) DeleteWordForward() {
+	if m.DeleteSelection() {
+		return
+	}
+	x, y := m.wordRightPosition()
+	m.deleteRange(m.CursorX, m.CursorY, x, y)
+}
+
+// DeleteToLineStart deletes from the start of the line to the cursor (Ctrl+U)
+func (m *Model) DeleteToLineStart() {
+	if m.DeleteSelection() {
+		return
+	}
+	m.deleteRange(0, m.CursorY, m.CursorX, m.CursorY)
+}
+
+// DeleteToLineEnd deletes from the cursor to the end of the line (Ctrl+K)
+func (m *Model) DeleteToLineEnd() {
+	if m.DeleteSelection() {
+		return
+	}
+	lines := strings.Split(m.Input, "\n")
+	m.deleteRange(m.CursorX, m.CursorY, len([]rune(lines[m.CursorY])), m.CursorY)
+}
+
+// HandleCursorKey moves the cursor for the arrow, Home/End and word motion actions.
+//
+// The select_ actions extend the selection to the new position, the others drop any selection.
+// Returns false if action doesn't move the cursor.
+func (m *Model) HandleCursorKey(action KeyAction) bool {
+	selecting := false
+	switch action {
+	case ActionSelectLeft, ActionSelectRight, ActionSelectUp, ActionSelectDown,
+		ActionSelectLineStart, ActionSelectLineEnd, ActionSelectWordLeft, ActionSelectWordRight:
+		selecting = true
+		if !m.IsHighlighting {
+			m.IsHighlighting = true
+			m.SelectionStartX = m.CursorX
+			m.SelectionStartY = m.CursorY
+		}
+	}
+
+	switch action {
+	case ActionLeft, ActionSelectLeft:
+		m.HandleHorizontalCursorMovement(tea.KeyLeft.String())
+	case ActionRight, ActionSelectRight:
+		m.HandleHorizontalCursorMovement(tea.KeyRight.String())
+	case ActionUp, ActionSelectUp:
+		m.HandleVerticalCursorMovement(tea.KeyUp.String())
+	case ActionDown, ActionSelectDown:
+		m.HandleVerticalCursorMovement(tea.KeyDown.String())
+	case ActionWordLeft, ActionSelectWordLeft:
+		m.MoveWordLeft()
+	case ActionWordRight, ActionSelectWordRight:
+		m.MoveWordRight()
+	case ActionLineStart, ActionSelectLineStart:
+		m.MoveToLineStart()
+	case ActionLineEnd, ActionSelectLineEnd:
+		m.MoveToLineEnd()
+	default:
+		return false
+	}
+
+	if !selecting {
+		m.ClearInputSelection()
+		return true
+	}
+	m.SelectionEndX = m.CursorX
+	m.SelectionEndY = m.CursorY
+	if m.SelectionEndX == m.SelectionStartX && m.SelectionEndY == m.SelectionStartY {
+		m.ClearInputSelection()
+	}
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
@@ -128,14 +129,59 @@ func PrintDiffs(diffs []LineDiff) {
 	}
 }
 
+// commandShell runs shell commands, "" for sh (cmd on Windows), see SetCommandShell
+var commandShell string
+
+// SetCommandShell picks the shell for running commands, checking that it exists
+func SetCommandShell(shell string) error {
+	if shell != "" {
+		if _, err := exec.LookPath(shell); err != nil {
+			return fmt.Errorf("shell %s not found: %v", shell, err)
+		}
+	}
+	commandShell = shell
+	return nil
+}
+
 // Runs a shell command
 func runShellCommand(command string) (string, error) {
 	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/C", command)
-	} else {
-		cmd = exec.Command("sh", "-c", command)
+	shell := commandShell
+	if shell == "" {
+		shell = "sh"
+		if runtime.GOOS == "windows" {
+			shell = "cmd"
+		}
+	}
+	switch strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe") {
+	case "cmd":
+		cmd = exec.Command(shell, "/C", command)
+	case "powershell", "pwsh":
+		cmd = exec.Command(shell, "-NoProfile", "-Command", command)
+	default:
+		cmd = exec.Command(shell, "-c", command)
 	}
 	output, err := cmd.CombinedOutput()
 	return string(output), err
 }
+
+// FileSnapshot is a file's content before the agent changed it, used by /undo
+type FileSnapshot struct {
+	Path    string
+	Content []byte
+	Existed bool
+}
+
+// snapshotFile records the current state of path so it can be restored
+func snapshotFile(path string) FileSnapshot {
+	content, err := os.ReadFile(path)
+	return FileSnapshot{Path: path, Content: content, Existed: err == nil}
+}
+
+// Restore puts the file back the way it was, deleting it if it didn't exist
+func (s FileSnapshot) Restore() error {
+	if !s.Existed {
+		return os.Remove(s.Path)
+	}
+	return os.WriteFile(s.Path, s.Content, 0644)
+}
@@ -0,0 +1,309 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/config"
+	"menace-go/llmServer"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// HelpOverlay is the state of the help page opened with /help or the sidebar button
+type HelpOverlay struct {
+	Open bool
+	// Scroll is the first visible line
+	Scroll int
+	// Typing is true while keys edit Query, which narrows the page to matching lines
+	Typing bool
+	Query  string
+	// Tools is the agent tools section, built when the page opens so rendering never waits on the agent
+	Tools helpSection
+}
+
+// helpSection is a titled block of the help page
+type helpSection struct {
+	Title string
+	// Scope is set for key binding sections
+	Scope KeyScope
+	Lines []string
+}
+
+// toolDescriptions explains the agent's tools, in the order of llmServer.AvailableFunctions
+var toolDescriptions = map[string]string{
+	llmServer.ShellTool:       "suggest shell commands for you to run",
+	"ReadFileWithLineNumbers": "read a file",
+	"CreateAndApplyDiffs":     "create and edit files",
+	"createPullRequest":       "open a GitHub pull request",
+	"remember":                "save a fact to long-term memory",
+	"recall":                  "search long-term memory",
+	"forget":                  "delete a memory",
+	llmServer.AskUserFunction: "ask you a multiple-choice question",
+}
+
+// helpSections is everything on the help page, generated from the current keymap, commands and config
+func (m *Model) helpSections() []helpSection {
+	commands := helpSection{Title: "Commands"}
+	for _, command := range allSlashCommands() {
+		usage := "/" + command.Name
+		if command.Usage != "" {
+			usage += " " + command.Usage
+		}
+		commands.Lines = append(commands.Lines, fmt.Sprintf("  %-24s %s", usage, command.Description))
+	}
+	sections := []helpSection{commands}
+
+	for _, section := range m.keymap.helpSections() {
+		if section.Scope == ScopeApproval {
+			section.Lines = append([]string{
+				"  Commands and file changes the agent suggests wait for your answer " + m.keymap.approvalHint() + ":",
+				"  approve runs the command or applies the change, reject tells the agent to stop,",
+				"  edit_command puts the command in the input so you can change it before sending.",
+				"  Questions and memory functions run without asking.",
+			}, section.Lines...)
+		}
+		sections = append(sections, section)
+	}
+
+	sections = append(sections, helpSection{Title: "Mouse", Lines: []string{
+		"  click a message          edit and resend it",
+		"  drag in the chat         select text, double-click selects a whole message",
+		"  click ▾ / [copy]         expand a long output, copy a code block",
+	}})
+	if m.Vim.Enabled {
+		sections = append(sections, helpSection{Title: "Vim mode (not remappable)", Lines: []string{
+			"  Esc for normal mode: hjkl w b e 0 ^ $ gg G f t, d c y with counts and iw/aw, p P u Ctrl+R, v V, \"a-\"z and \"+ registers",
+		}})
+	}
+
+	sections = append(sections, m.Help.Tools)
+
+	sections = append(sections, helpSection{Title: "Config files", Lines: []string{
+		fmt.Sprintf("  %-24s %s", "User config", config.UserFile()),
+		fmt.Sprintf("  %-24s %s", "Project config", config.ProjectFile()),
+		fmt.Sprintf("  %-24s %s", "User instructions", filepath.Join(config.UserDir(), llmServer.InstructionsFileName)),
+		fmt.Sprintf("  %-24s %s", "Project instructions", llmServer.InstructionsFileName+" in the working directory and its parents"),
+		fmt.Sprintf("  %-24s %s", "User commands", filepath.Join(config.UserDir(), CommandsDirName)),
+		fmt.Sprintf("  %-24s %s", "Project commands", filepath.Join(config.ProjectDir(), CommandsDirName)),
+		fmt.Sprintf("  %-24s %s", "Memory", llmServer.DefaultMemoryPath()),
+		"  Rebind keys in the \"keys\" section of the config, see the action IDs above.",
+	}})
+	return sections
+}
+
+// toolsHelpSection lists the agent's tools and whether the current persona allows them
+func (m *Model) toolsHelpSection() helpSection {
+	tools := helpSection{Title: "Agent tools"}
+	persona := m.agent.Persona()
+	for _, name := range append([]string{llmServer.ShellTool}, llmServer.AvailableFunctions...) {
+		line := fmt.Sprintf("  %-24s %s", name, toolDescriptions[name])
+		if !m.agent.ToolAllowed(name) {
+			line += " (not allowed by the " + persona + " persona)"
+		}
+		tools.Lines = append(tools.Lines, line)
+	}
+	return tools
+}
+
+// helpLines renders the help page wrapped to width, keeping only lines that match the query.
+//
+// Section titles are kept for sections with a match.
+func (m *Model) helpLines(width int) []string {
+	query := strings.ToLower(m.Help.Query)
+	var lines []string
+	for _, section := range m.helpSections() {
+		var matched []string
+		for _, line := range section.Lines {
+			if query != "" && !strings.Contains(strings.ToLower(line), query) {
+				continue
+			}
+			for _, wrapped := range wrapHelpLine(line, width) {
+				matched = append(matched, highlightQuery(wrapped, query))
+			}
+		}
+		if len(matched) == 0 && query != "" {
+			continue
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, SectionHeaderStyle.Render(section.Title))
+		lines = append(lines, matched...)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "Nothing matches \""+m.Help.Query+"\"")
+	}
+	return lines
+}
+
+// helpColumn is where descriptions start in "  %-24s %s" help lines
+const helpColumn = 27
+
+// wrapHelpLine wraps a help line to width, continuation lines line up with the description column
+func wrapHelpLine(line string, width int) []string {
+	indent := 4
+	if len(line) > helpColumn && line[helpColumn-1] == ' ' && width > 2*helpColumn {
+		indent = helpColumn
+	}
+	lines := strings.Split(ansi.Wrap(line, width, ""), "\n")
+	if len(lines) == 1 {
+		return lines
+	}
+	rest := strings.Join(lines[1:], " ")
+	wrapped := strings.Split(ansi.Wrap(rest, max(width-indent, 1), ""), "\n")
+	for i := range wrapped {
+		wrapped[i] = strings.Repeat(" ", indent) + wrapped[i]
+	}
+	return append(lines[:1], wrapped...)
+}
+
+// highlightQuery marks every case-insensitive match of query in a plain line
+func highlightQuery(line string, query string) string {
+	if query == "" {
+		return line
+	}
+	lower := strings.ToLower(line)
+	var sb strings.Builder
+	for {
+		i := strings.Index(lower, query)
+		// Lowercasing can change byte lengths, then the offsets don't line up
+		if i < 0 || len(lower) != len(line) {
+			break
+		}
+		sb.WriteString(line[:i] + SearchMatchStyle.Render(line[i:i+len(query)]))
+		line, lower = line[i+len(query):], lower[i+len(query):]
+	}
+	sb.WriteString(line)
+	return sb.String()
+}
+
+// helpPageSize is how many help lines fit on the page for a terminal height
+func helpPageSize(termHeight int) int {
+	// Border, padding, title and the search line
+	return max(termHeight-5-2-2-2, 1)
+}
+
+// HelpView renders the help page
+func (m *Model) HelpView(termHeight, termWidth int) string {
+	lines := m.helpLines(termWidth - 24 - 2)
+	visible := helpPageSize(termHeight)
+	// The terminal may have grown since the last scroll
+	scroll := max(min(m.Help.Scroll, len(lines)-visible), 0)
+	end := min(scroll+visible, len(lines))
+
+	var content strings.Builder
+	title := "Help"
+	if len(lines) > visible {
+		title += fmt.Sprintf(" (%d-%d of %d)", scroll+1, end, len(lines))
+	}
+	content.WriteString(HeaderStyle.Render(title) + "\n")
+	content.WriteString(strings.Join(lines[scroll:end], "\n"))
+	for i := end - scroll; i < visible; i++ {
+		content.WriteString("\n")
+	}
+	content.WriteString("\n\n" + m.renderHelpSearch())
+
+	helpBox := PageStyle.
+		Width(termWidth - 24).
+		Height(termHeight - 5).
+		Render(content.String())
+
+	return zone.Scan(lipgloss.NewStyle().
+		Margin(0, 2).
+		Render(helpBox))
+}
+
+// renderHelpSearch is the search line and controls at the bottom of the help page
+func (m *Model) renderHelpSearch() string {
+	k := m.keymap
+	if m.Help.Typing {
+		return QuestionStyle.Render("Search: ") + m.Help.Query + CursorStyle.Render(" ") + "  " +
+			CommandPopupStyle.Render(k.ShortHelp(ActionSearchDone)+": done  "+k.ShortHelp(ActionSearchClose)+": clear")
+	}
+	controls := k.ShortHelp(ActionMenuUp) + "/" + k.ShortHelp(ActionMenuDown) + "/" + k.ShortHelp(ActionPageUp) + "/" +
+		k.ShortHelp(ActionPageDown) + ": scroll  " + k.ShortHelp(ActionSearchEdit) + ": search  " + k.ShortHelp(ActionMenuClose) + ": close"
+	if m.Help.Query != "" {
+		return QuestionStyle.Render("Search: ") + m.Help.Query + "  " + CommandPopupStyle.Render(controls)
+	}
+	return CommandPopupStyle.Render(controls)
+}
+
+// OpenHelp opens the help page
+func (m *Model) OpenHelp() {
+	m.Help = HelpOverlay{Open: true, Tools: m.toolsHelpSection()}
+}
+
+// CloseHelp closes the help page
+func (m *Model) CloseHelp() {
+	m.Help = HelpOverlay{}
+}
+
+// helpLastScroll is the scroll offset that shows the last page of help
+func (m *Model) helpLastScroll() int {
+	termWidth, termHeight := m.Width, m.Height
+	if termWidth == 0 || termHeight == 0 {
+		termWidth, termHeight = 80, 20
+	}
+	return max(len(m.helpLines(termWidth-24-2))-helpPageSize(termHeight), 0)
+}
+
+// ScrollHelp moves the help page by n lines, stopping at the last page
+func (m *Model) ScrollHelp(n int) {
+	m.Help.Scroll = max(min(m.Help.Scroll+n, m.helpLastScroll()), 0)
+}
+
+// HandleHelpKey handles key presses while the help page is open
+func (m *Model) HandleHelpKey(msg tea.KeyMsg) {
+	key := msg.String()
+	if m.Help.Typing {
+		text := msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace
+		switch {
+		case text && !msg.Paste:
+			m.Help.Query += string(msg.Runes)
+			m.Help.Scroll = 0
+		case msg.Type == tea.KeyBackspace:
+			if runes := []rune(m.Help.Query); len(runes) > 0 {
+				m.Help.Query = string(runes[:len(runes)-1])
+			}
+			m.Help.Scroll = 0
+		case m.keymap.Action(ScopeSearch, key) == ActionSearchDone:
+			m.Help.Typing = false
+		case m.keymap.Action(ScopeSearch, key) == ActionSearchClose:
+			m.Help.Typing = false
+			m.Help.Query = ""
+			m.Help.Scroll = 0
+		}
+		return
+	}
+
+	page := helpPageSize(m.Height)
+	if m.keymap.Action(ScopeSearch, key) == ActionSearchEdit {
+		m.Help.Typing = true
+		return
+	}
+	switch m.keymap.Action(ScopeMenu, key) {
+	case ActionMenuClose:
+		m.CloseHelp()
+		return
+	case ActionMenuUp:
+		m.ScrollHelp(-1)
+		return
+	case ActionMenuDown:
+		m.ScrollHelp(1)
+		return
+	}
+	switch m.keymap.Action(ScopeInput, key) {
+	case ActionPageUp:
+		m.ScrollHelp(-page)
+	case ActionPageDown:
+		m.ScrollHelp(page)
+	case ActionScrollTop:
+		m.Help.Scroll = 0
+	case ActionScrollBottom:
+		m.Help.Scroll = m.helpLastScroll()
+	}
+}
@@ -0,0 +1,410 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// KeyAction identifies something a key can do, it is the name used in the "keys" section of the config file
+type KeyAction string
+
+// KeyScope is where a binding applies. Keys only conflict with other keys in the same scope.
+type KeyScope string
+
+const (
+	// ScopeInput is the input box and the chat, the default state
+	ScopeInput KeyScope = "input"
+	// ScopeApproval is while a suggested command waits for approval
+	ScopeApproval KeyScope = "approval"
+	// ScopeMenu is the pickers and popups: slash commands, questions, models and memories
+	ScopeMenu KeyScope = "menu"
+	// ScopeSearch is while the Ctrl+F search bar is open
+	ScopeSearch KeyScope = "search"
+)
+
+const (
+	ActionSend              KeyAction = "send"
+	ActionNewline           KeyAction = "newline"
+	ActionComplete          KeyAction = "complete"
+	ActionCancel            KeyAction = "cancel"
+	ActionCopy              KeyAction = "copy"
+	ActionQuit              KeyAction = "quit"
+	ActionCut               KeyAction = "cut"
+	ActionPaste             KeyAction = "paste"
+	ActionSelectAll         KeyAction = "select_all"
+	ActionUndo              KeyAction = "undo"
+	ActionRedo              KeyAction = "redo"
+	ActionLeft              KeyAction = "cursor_left"
+	ActionRight             KeyAction = "cursor_right"
+	ActionUp                KeyAction = "cursor_up"
+	ActionDown              KeyAction = "cursor_down"
+	ActionWordLeft          KeyAction = "word_left"
+	ActionWordRight         KeyAction = "word_right"
+	ActionLineStart         KeyAction = "line_start"
+	ActionLineEnd           KeyAction = "line_end"
+	ActionSelectLeft        KeyAction = "select_left"
+	ActionSelectRight       KeyAction = "select_right"
+	ActionSelectUp          KeyAction = "select_up"
+	ActionSelectDown        KeyAction = "select_down"
+	ActionSelectWordLeft    KeyAction = "select_word_left"
+	ActionSelectWordRight   KeyAction = "select_word_right"
+	ActionSelectLineStart   KeyAction = "select_line_start"
+	ActionSelectLineEnd     KeyAction = "select_line_end"
+	ActionDeleteBack        KeyAction = "delete_back"
+	ActionDeleteForward     KeyAction = "delete_forward"
+	ActionDeleteWordBack    KeyAction = "delete_word_back"
+	ActionDeleteWordForward KeyAction = "delete_word_forward"
+	ActionDeleteToLineStart KeyAction = "delete_to_line_start"
+	ActionDeleteToLineEnd   KeyAction = "delete_to_line_end"
+	ActionPageUp            KeyAction = "page_up"
+	ActionPageDown          KeyAction = "page_down"
+	ActionScrollTop         KeyAction = "scroll_top"
+	ActionScrollBottom      KeyAction = "scroll_bottom"
+	ActionPrevMessage       KeyAction = "prev_message"
+	ActionNextMessage       KeyAction = "next_message"
+	ActionSearch            KeyAction = "search"
+	ActionToggleOutput      KeyAction = "toggle_output"
+
+	ActionApprove     KeyAction = "approve"
+	ActionReject      KeyAction = "reject"
+	ActionEditCommand KeyAction = "edit_command"
+
+	ActionMenuUp         KeyAction = "menu_up"
+	ActionMenuDown       KeyAction = "menu_down"
+	ActionMenuSelect     KeyAction = "menu_select"
+	ActionMenuClose      KeyAction = "menu_close"
+	ActionMenuDelete     KeyAction = "menu_delete"
+	ActionMenuNextTab    KeyAction = "menu_next_tab"
+	ActionMenuPrevTab    KeyAction = "menu_prev_tab"
+	ActionSettingsTarget KeyAction = "settings_target"
+	ActionModelPull      KeyAction = "model_pull"
+	ActionModelDelete    KeyAction = "model_delete"
+	ActionModelInspect   KeyAction = "model_inspect"
+
+	ActionSearchDone  KeyAction = "search_done"
+	ActionSearchClose KeyAction = "search_close"
+	ActionSearchOlder KeyAction = "search_older"
+	ActionSearchNewer KeyAction = "search_newer"
+	ActionSearchEdit  KeyAction = "search_edit"
+)
+
+// KeyBinding is an action, where it applies and the keys bound to it
+type KeyBinding struct {
+	Action KeyAction
+	Scope  KeyScope
+	Keys   []string
+	Help   string
+	// Fallback gets the key when this action has nothing to do, so the two may share keys
+	Fallback KeyAction
+}
+
+// defaultKeyBindings are the built-in bindings, in the order the help lists them
+var defaultKeyBindings = []KeyBinding{
+	{Action: ActionSend, Scope: ScopeInput, Keys: []string{"enter"}, Help: "send the message"},
+	{Action: ActionNewline, Scope: ScopeInput, Keys: []string{"alt+enter", "ctrl+j"}, Help: "insert a new line"},
+	{Action: ActionComplete, Scope: ScopeInput, Keys: []string{"tab"}, Help: "complete @file mentions and /commands"},
+	{Action: ActionCancel, Scope: ScopeInput, Keys: []string{"esc"}, Help: "cancel editing a message, clear the chat selection"},
+	{Action: ActionCopy, Scope: ScopeInput, Keys: []string{"ctrl+c"}, Help: "copy the selected text", Fallback: ActionQuit},
+	{Action: ActionQuit, Scope: ScopeInput, Keys: []string{"ctrl+c"}, Help: "quit (when nothing is selected)"},
+	{Action: ActionCut, Scope: ScopeInput, Keys: []string{"ctrl+x"}, Help: "cut the selected text"},
+	{Action: ActionPaste, Scope: ScopeInput, Keys: []string{"ctrl+v"}, Help: "paste text or an image"},
+	{Action: ActionSelectAll, Scope: ScopeInput, Keys: []string{"ctrl+a"}, Help: "select all input"},
+	{Action: ActionUndo, Scope: ScopeInput, Keys: []string{"ctrl+z"}, Help: "undo"},
+	{Action: ActionRedo, Scope: ScopeInput, Keys: []string{"ctrl+y"}, Help: "redo"},
+	{Action: ActionLeft, Scope: ScopeInput, Keys: []string{"left"}, Help: "move left"},
+	{Action: ActionRight, Scope: ScopeInput, Keys: []string{"right"}, Help: "move right"},
+	{Action: ActionUp, Scope: ScopeInput, Keys: []string{"up"}, Help: "move up"},
+	{Action: ActionDown, Scope: ScopeInput, Keys: []string{"down"}, Help: "move down"},
+	{Action: ActionWordLeft, Scope: ScopeInput, Keys: []string{"ctrl+left", "alt+b", "alt+left"}, Help: "move to the previous word"},
+	{Action: ActionWordRight, Scope: ScopeInput, Keys: []string{"ctrl+right", "alt+f", "alt+right"}, Help: "move to the next word"},
+	{Action: ActionLineStart, Scope: ScopeInput, Keys: []string{"home"}, Help: "start of the line, top of the chat with an empty input"},
+	{Action: ActionLineEnd, Scope: ScopeInput, Keys: []string{"end", "ctrl+e"}, Help: "end of the line, bottom of the chat with an empty input"},
+	{Action: ActionSelectLeft, Scope: ScopeInput, Keys: []string{"shift+left"}, Help: "select left"},
+	{Action: ActionSelectRight, Scope: ScopeInput, Keys: []string{"shift+right"}, Help: "select right"},
+	{Action: ActionSelectUp, Scope: ScopeInput, Keys: []string{"shift+up"}, Help: "select up"},
+	{Action: ActionSelectDown, Scope: ScopeInput, Keys: []string{"shift+down"}, Help: "select down"},
+	{Action: ActionSelectWordLeft, Scope: ScopeInput, Keys: []string{"ctrl+shift+left"}, Help: "select to the previous word"},
+	{Action: ActionSelectWordRight, Scope: ScopeInput, Keys: []string{"ctrl+shift+right"}, Help: "select to the next word"},
+	{Action: ActionSelectLineStart, Scope: ScopeInput, Keys: []string{"shift+home"}, Help: "select to the start of the line"},
+	{Action: ActionSelectLineEnd, Scope: ScopeInput, Keys: []string{"shift+end"}, Help: "select to the end of the line"},
+	{Action: ActionDeleteBack, Scope: ScopeInput, Keys: []string{"backspace"}, Help: "delete the previous character, or the last attachment"},
+	{Action: ActionDeleteForward, Scope: ScopeInput, Keys: []string{"delete", "ctrl+d"}, Help: "delete the next character"},
+	{Action: ActionDeleteWordBack, Scope: ScopeInput, Keys: []string{"ctrl+w", "ctrl+h", "alt+backspace"}, Help: "delete the previous word"},
+	{Action: ActionDeleteWordForward, Scope: ScopeInput, Keys: []string{"alt+d", "alt+delete"}, Help: "delete the next word"},
+	{Action: ActionDeleteToLineStart, Scope: ScopeInput, Keys: []string{"ctrl+u"}, Help: "delete to the start of the line"},
+	{Action: ActionDeleteToLineEnd, Scope: ScopeInput, Keys: []string{"ctrl+k"}, Help: "delete to the end of the line"},
+	{Action: ActionPageUp, Scope: ScopeInput, Keys: []string{"pgup"}, Help: "scroll the chat up a page"},
+	{Action: ActionPageDown, Scope: ScopeInput, Keys: []string{"pgdown"}, Help: "scroll the chat down a page"},
+	{Action: ActionScrollTop, Scope: ScopeInput, Keys: []string{"ctrl+home"}, Help: "jump to the top of the chat"},
+	{Action: ActionScrollBottom, Scope: ScopeInput, Keys: []string{"ctrl+end"}, Help: "jump to the bottom of the chat"},
+	{Action: ActionPrevMessage, Scope: ScopeInput, Keys: []string{"ctrl+up"}, Help: "jump to the previous message you sent"},
+	{Action: ActionNextMessage, Scope: ScopeInput, Keys: []string{"ctrl+down"}, Help: "jump to the next message you sent"},
+	{Action: ActionSearch, Scope: ScopeInput, Keys: []string{"ctrl+f"}, Help: "search the chat"},
+	{Action: ActionToggleOutput, Scope: ScopeInput, Keys: []string{"ctrl+o"}, Help: "expand or collapse the long output on screen"},
+
+	{Action: ActionApprove, Scope: ScopeApproval, Keys: []string{"y"}, Help: "run the suggested command"},
+	{Action: ActionReject, Scope: ScopeApproval, Keys: []string{"n"}, Help: "reject it"},
+	{Action: ActionEditCommand, Scope: ScopeApproval, Keys: []string{"e"}, Help: "edit it in the input box"},
+
+	{Action: ActionMenuUp, Scope: ScopeMenu, Keys: []string{"up"}, Help: "previous entry"},
+	{Action: ActionMenuDown, Scope: ScopeMenu, Keys: []string{"down"}, Help: "next entry"},
+	{Action: ActionMenuSelect, Scope: ScopeMenu, Keys: []string{"enter"}, Help: "pick the entry, or send the typed answer"},
+	{Action: ActionMenuClose, Scope: ScopeMenu, Keys: []string{"esc"}, Help: "close, or dismiss the agent's question"},
+	{Action: ActionMenuDelete, Scope: ScopeMenu, Keys: []string{"d", "delete"}, Help: "delete the selected memory"},
+	{Action: ActionMenuNextTab, Scope: ScopeMenu, Keys: []string{"tab", "right"}, Help: "next settings tab"},
+	{Action: ActionMenuPrevTab, Scope: ScopeMenu, Keys: []string{"shift+tab", "left"}, Help: "previous settings tab"},
+	{Action: ActionSettingsTarget, Scope: ScopeMenu, Keys: []string{"ctrl+t"}, Help: "save settings to the user or the project config"},
+	{Action: ActionModelPull, Scope: ScopeMenu, Keys: []string{"ctrl+p"}, Help: "pull the Ollama model named in the filter, or update the selected one"},
+	{Action: ActionModelDelete, Scope: ScopeMenu, Keys: []string{"ctrl+d"}, Help: "delete the selected Ollama model, press twice"},
+	{Action: ActionModelInspect, Scope: ScopeMenu, Keys: []string{"ctrl+o"}, Help: "show the selected Ollama model's details and runtime options"},
+
+	{Action: ActionSearchDone, Scope: ScopeSearch, Keys: []string{"enter"}, Help: "stop typing the query"},
+	{Action: ActionSearchClose, Scope: ScopeSearch, Keys: []string{"esc"}, Help: "close the search"},
+	{Action: ActionSearchOlder, Scope: ScopeSearch, Keys: []string{"n", "ctrl+n", "up"}, Help: "older match"},
+	{Action: ActionSearchNewer, Scope: ScopeSearch, Keys: []string{"N", "ctrl+p", "down"}, Help: "newer match"},
+	{Action: ActionSearchEdit, Scope: ScopeSearch, Keys: []string{"/", "ctrl+f"}, Help: "edit the query"},
+}
+
+// scopeTitles head each scope in the help
+var scopeTitles = map[KeyScope]string{
+	ScopeInput:    "Keys",
+	ScopeApproval: "Command approval",
+	ScopeMenu:     "Menus and pickers",
+	ScopeSearch:   "Search (letters type into the query until search_done)",
+}
+
+// Keymap is the active key bindings, the defaults with the config's "keys" section on top
+type Keymap struct {
+	bindings []KeyBinding
+	// actions by scope and key, the first binding in the table wins a conflict
+	byKey map[KeyScope]map[string]KeyAction
+}
+
+// NewKeymap applies overrides, action ID to keys, to the default bindings.
+//
+// An empty list unbinds the action. Unknown actions and keys and conflicting bindings are
+// returned as errors, the rest of the keymap still works.
+func NewKeymap(overrides map[string][]string) (*Keymap, []error) {
+	var errs []error
+	bindings := make([]KeyBinding, len(defaultKeyBindings))
+	copy(bindings, defaultKeyBindings)
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		i := bindingIndex(bindings, KeyAction(name))
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("unknown action %q", name))
+			continue
+		}
+		var keys []string
+		for _, key := range overrides[name] {
+			key = normalizeKey(key)
+			if !validKey(key) {
+				errs = append(errs, fmt.Errorf("unknown key %q for %s", key, name))
+				continue
+			}
+			keys = append(keys, key)
+		}
+		bindings[i].Keys = keys
+	}
+
+	k := &Keymap{bindings: bindings, byKey: map[KeyScope]map[string]KeyAction{}}
+	for _, binding := range bindings {
+		scope := k.byKey[binding.Scope]
+		if scope == nil {
+			scope = map[string]KeyAction{}
+			k.byKey[binding.Scope] = scope
+		}
+		for _, key := range binding.Keys {
+			existing, taken := scope[key]
+			if !taken {
+				scope[key] = binding.Action
+				continue
+			}
+			if bindings[bindingIndex(bindings, existing)].Fallback != binding.Action && existing != binding.Action {
+				errs = append(errs, fmt.Errorf("%s is bound to both %s and %s (%s keys), %s wins",
+					displayKey(key), existing, binding.Action, binding.Scope, existing))
+			}
+		}
+	}
+	return k, errs
+}
+
+// bindingIndex finds action in bindings, -1 if it doesn't exist
+func bindingIndex(bindings []KeyBinding, action KeyAction) int {
+	for i, binding := range bindings {
+		if binding.Action == action {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeKey spells a key the way tea.KeyMsg.String does
+func normalizeKey(key string) string {
+	if key == " " {
+		return key
+	}
+	key = strings.TrimSpace(key)
+	if utf8.RuneCountInString(key) == 1 {
+		return key
+	}
+	key = strings.ToLower(key)
+	switch key {
+	case "space":
+		return " "
+	case "escape":
+		return "esc"
+	case "return":
+		return "enter"
+	case "pageup":
+		return "pgup"
+	case "pagedown", "pgdn":
+		return "pgdown"
+	}
+	return key
+}
+
+// keyNames are the names Bubble Tea gives special keys
+var keyNames = func() map[string]bool {
+	names := map[string]bool{}
+	for t := tea.KeyType(-200); t <= 127; t++ {
+		if name := t.String(); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// validKey is true for a single character or a key Bubble Tea can report, with an optional alt+
+func validKey(key string) bool {
+	key = strings.TrimPrefix(key, "alt+")
+	return utf8.RuneCountInString(key) == 1 || keyNames[key]
+}
+
+// Action returns what key does in scope, "" if nothing
+func (k *Keymap) Action(scope KeyScope, key string) KeyAction {
+	return k.byKey[scope][key]
+}
+
+// Matches is true if key is bound to action
+func (k *Keymap) Matches(key string, action KeyAction) bool {
+	for _, binding := range k.bindings {
+		if binding.Action == action {
+			for _, bound := range binding.Keys {
+				if bound == key {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Bound reports whether any key triggers action
+func (k *Keymap) Bound(action KeyAction) bool {
+	i := bindingIndex(k.bindings, action)
+	return i >= 0 && len(k.bindings[i].Keys) > 0
+}
+
+// KeyHelp lists the keys bound to action for display, e.g. "Ctrl+Z"
+func (k *Keymap) KeyHelp(action KeyAction) string {
+	i := bindingIndex(k.bindings, action)
+	if i < 0 || len(k.bindings[i].Keys) == 0 {
+		return "unbound"
+	}
+	keys := make([]string, len(k.bindings[i].Keys))
+	for j, key := range k.bindings[i].Keys {
+		keys[j] = displayKey(key)
+	}
+	return strings.Join(keys, " / ")
+}
+
+// ShortHelp is the first key bound to action, for hints where space is tight
+func (k *Keymap) ShortHelp(action KeyAction) string {
+	i := bindingIndex(k.bindings, action)
+	if i < 0 || len(k.bindings[i].Keys) == 0 {
+		return "unbound"
+	}
+	return displayKey(k.bindings[i].Keys[0])
+}
+
+// approvalHint is the "(y/n/e)" shown after a suggested command
+func (k *Keymap) approvalHint() string {
+	return "(" + k.ShortHelp(ActionApprove) + "/" + k.ShortHelp(ActionReject) + "/" + k.ShortHelp(ActionEditCommand) + ")"
+}
+
+// menuControls is the controls footer of the full-screen pages
+func (k *Keymap) menuControls(actions ...KeyAction) string {
+	labels := map[KeyAction]string{
+		ActionMenuSelect: "Select",
+		ActionMenuDelete: "Forget",
+		ActionMenuClose:  "Back",
+		// The settings page
+		ActionSettingsTarget: "Save to the user or project config",
+		// The model picker
+		ActionModelPull:    "Pull (type a name) or update",
+		ActionModelDelete:  "Delete",
+		ActionModelInspect: "Details and options",
+	}
+	controls := "\n" + k.ShortHelp(ActionMenuUp) + "/" + k.ShortHelp(ActionMenuDown) + ": Navigate"
+	for _, action := range actions {
+		controls += "\n" + k.KeyHelp(action) + ": " + labels[action]
+	}
+	return controls
+}
+
+// helpSections lists every binding grouped by scope, generated from the active keymap
+func (k *Keymap) helpSections() []helpSection {
+	var sections []helpSection
+	for _, binding := range k.bindings {
+		if len(sections) == 0 || sections[len(sections)-1].Scope != binding.Scope {
+			sections = append(sections, helpSection{Title: scopeTitles[binding.Scope], Scope: binding.Scope})
+		}
+		section := &sections[len(sections)-1]
+		section.Lines = append(section.Lines, fmt.Sprintf("  %-24s %-22s %s", k.KeyHelp(binding.Action), binding.Action, binding.Help))
+	}
+	return sections
+}
+
+// displayKey spells a key for people, e.g. "ctrl+shift+left" becomes "Ctrl+Shift+←"
+func displayKey(key string) string {
+	if key == " " {
+		return "Space"
+	}
+	if utf8.RuneCountInString(key) == 1 {
+		return key
+	}
+	parts := strings.Split(key, "+")
+	for i, part := range parts {
+		switch part {
+		case "left":
+			parts[i] = "←"
+		case "right":
+			parts[i] = "→"
+		case "up":
+			parts[i] = "↑"
+		case "down":
+			parts[i] = "↓"
+		case "pgup":
+			parts[i] = "PgUp"
+		case "pgdown":
+			parts[i] = "PgDn"
+		default:
+			if utf8.RuneCountInString(part) > 1 {
+				parts[i] = strings.ToUpper(part[:1]) + part[1:]
+			} else if i > 0 {
+				parts[i] = strings.ToUpper(part)
+			}
+		}
+	}
+	return strings.Join(parts, "+")
+}
@@ -0,0 +1,204 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	glamouransi "github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/cellbuf"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// maxMarkdownCache bounds the rendered message cache, it is cleared when full
+const maxMarkdownCache = 512
+
+// markdownSegment is a run of prose or one fenced code block from an assistant message
+type markdownSegment struct {
+	Code     bool
+	Language string
+	// Text is the prose, or the code without its fences
+	Text string
+}
+
+var (
+	// Renderers by wrap width, creating one is slow
+	markdownRenderers = map[int]*glamour.TermRenderer{}
+	// Rendered lines by width, message index and content, View runs on every keypress
+	markdownCache = map[string][]string{}
+	// Glamour style for the current theme, see ApplyTheme
+	markdownBaseStyle = styles.DarkStyleConfig
+)
+
+// codeZone is the bubblezone ID of the copy button of code block n in message i
+func codeZone(i int, n int) string {
+	return fmt.Sprintf("code-%d-%d", i, n)
+}
+
+// splitMarkdown cuts a message into prose and fenced code blocks.
+//
+// An unclosed fence runs to the end of the message, as it does while the model is still writing.
+func splitMarkdown(content string) []markdownSegment {
+	var segments []markdownSegment
+	var current []string
+	var fence string
+	language := ""
+
+	flush := func(code bool) {
+		if len(current) > 0 || code {
+			segments = append(segments, markdownSegment{Code: code, Language: language, Text: strings.Join(current, "\n")})
+		}
+		current = nil
+	}
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if fence == "" && indent <= 3 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			flush(false)
+			fence = trimmed[:3]
+			language = strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			continue
+		}
+		if fence != "" && strings.HasPrefix(trimmed, fence) && strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1])) == "" {
+			flush(true)
+			fence = ""
+			language = ""
+			continue
+		}
+		current = append(current, line)
+	}
+	if fence != "" {
+		flush(true)
+	} else {
+		flush(false)
+	}
+	return segments
+}
+
+// markdownStyle is the theme's glamour style without the document and code block margins,
+// the chat box already pads its content
+func markdownStyle() glamouransi.StyleConfig {
+	style := markdownBaseStyle
+	noMargin := uint(0)
+	style.Document.Margin = &noMargin
+	style.Document.BlockPrefix = ""
+	style.Document.BlockSuffix = ""
+	style.CodeBlock.Margin = &noMargin
+	return style
+}
+
+// markdownRenderer returns the cached renderer for width
+func markdownRenderer(width int) (*glamour.TermRenderer, error) {
+	if renderer, ok := markdownRenderers[width]; ok {
+		return renderer, nil
+	}
+	renderer, err := glamour.NewTermRenderer(
+		glamour.WithStyles(markdownStyle()),
+		glamour.WithColorProfile(lipgloss.ColorProfile()),
+		glamour.WithWordWrap(width),
+	)
+	if err != nil {
+		return nil, err
+	}
+	markdownRenderers[width] = renderer
+	return renderer, nil
+}
+
+// renderMarkdownText renders markdown to lines no wider than width, falling back to plain wrapping
+func renderMarkdownText(text string, width int) []string {
+	renderer, err := markdownRenderer(width)
+	var out string
+	if err == nil {
+		out, err = renderer.Render(text)
+	}
+	if err != nil {
+		out = cellbuf.Wrap(text, width, "")
+	}
+
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		// Code blocks aren't word wrapped by glamour
+		lines = append(lines, strings.Split(cellbuf.Wrap(line, width, ""), "\n")...)
+	}
+	// Drop the blank lines glamour puts around blocks
+	for len(lines) > 0 && strings.TrimSpace(ansi.Strip(lines[0])) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(ansi.Strip(lines[len(lines)-1])) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// renderAgentMarkdown renders assistant message i as terminal markdown.
+//
+// Each fenced code block gets a header with its language and a clickable copy button.
+func renderAgentMarkdown(i int, content string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	key := fmt.Sprintf("%d\x00%d\x00%s", width, i, content)
+	if lines, ok := markdownCache[key]; ok {
+		return lines
+	}
+
+	var lines []string
+	n := 0
+	for _, segment := range splitMarkdown(content) {
+		if !segment.Code {
+			if strings.TrimSpace(segment.Text) == "" {
+				continue
+			}
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, renderMarkdownText(segment.Text, width)...)
+			continue
+		}
+
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		label := segment.Language
+		if label == "" {
+			label = "code"
+		}
+		lines = append(lines, CodeHeaderStyle.Render("── "+label+" ")+zone.Mark(codeZone(i, n), CodeCopyStyle.Render("[copy]")))
+		// Tabs have no width when wrapping
+		fenced := "```" + segment.Language + "\n" + strings.ReplaceAll(segment.Text, "\t", "    ") + "\n```"
+		lines = append(lines, renderMarkdownText(fenced, width)...)
+		n++
+	}
+
+	if len(markdownCache) >= maxMarkdownCache {
+		markdownCache = map[string][]string{}
+	}
+	markdownCache[key] = lines
+	return lines
+}
+
+// HandleCodeCopyClick copies the code block whose copy button was clicked
+func (m *Model) HandleCodeCopyClick(msg tea.MouseMsg) bool {
+	for i, message := range m.Messages {
+		if message.Kind != KindAgent {
+			continue
+		}
+		n := 0
+		for _, segment := range splitMarkdown(message.Content) {
+			if !segment.Code {
+				continue
+			}
+			if zone.Get(codeZone(i, n)).InBounds(msg) {
+				m.CopyToClipboard(segment.Text)
+				m.AddSystemMessage("Copied code block to clipboard")
+				return true
+			}
+			n++
+		}
+	}
+	return false
+}
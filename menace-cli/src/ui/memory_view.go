@@ -0,0 +1,87 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+)
+
+// MemoryView renders the /memory page listing what the agent remembers
+func (m *Model) MemoryView(termHeight, termWidth int) string {
+	var content strings.Builder
+	content.WriteString(HeaderStyle.Render("Memory") + "\n\n")
+
+	if len(m.MemoryItems) == 0 {
+		content.WriteString("Nothing remembered yet for this project.\n")
+	}
+	for i, memory := range m.MemoryItems {
+		style := lipgloss.NewStyle()
+		if i == m.MemoryCursor {
+			style = MenuSelectedStyle
+		}
+		line := fmt.Sprintf("> [%s] %-7s %s  %s", memory.ID, memory.Scope, memory.Created.Format("2006-01-02"), memory.Content)
+		content.WriteString(style.Render(line) + "\n")
+	}
+
+	content.WriteString("\n" + HeaderStyle.Render("Controls:"))
+	content.WriteString(m.keymap.menuControls(ActionMenuDelete, ActionMenuClose))
+
+	memoryBox := PageStyle.
+		Width(termWidth - 24).
+		Height(termHeight - 5).
+		Render(content.String())
+
+	return zone.Scan(lipgloss.NewStyle().
+		Margin(0, 2).
+		Render(memoryBox))
+}
+
+// OpenMemory opens the memory page
+func (m *Model) OpenMemory() {
+	memories, err := m.agent.Memories()
+	if err != nil {
+		m.AddErrorMessage(err)
+		return
+	}
+	m.IsMemoryOpen = true
+	m.MemoryCursor = 0
+	m.MemoryItems = memories
+}
+
+// CloseMemory closes the memory page
+func (m *Model) CloseMemory() {
+	m.IsMemoryOpen = false
+	m.MemoryCursor = 0
+	m.MemoryItems = nil
+}
+
+// HandleMemoryKey handles key presses while the memory page is open
+func (m *Model) HandleMemoryKey(key string) {
+	switch m.keymap.Action(ScopeMenu, key) {
+	case ActionMenuClose:
+		m.CloseMemory()
+	case ActionMenuUp:
+		if m.MemoryCursor > 0 {
+			m.MemoryCursor--
+		}
+	case ActionMenuDown:
+		if m.MemoryCursor < len(m.MemoryItems)-1 {
+			m.MemoryCursor++
+		}
+	case ActionMenuDelete:
+		if m.MemoryCursor >= len(m.MemoryItems) {
+			return
+		}
+		memory := m.MemoryItems[m.MemoryCursor]
+		if _, err := m.agent.Forget(memory.ID); err != nil {
+			m.AddErrorMessage(err)
+			return
+		}
+		m.MemoryItems = append(m.MemoryItems[:m.MemoryCursor], m.MemoryItems[m.MemoryCursor+1:]...)
+		if m.MemoryCursor > 0 && m.MemoryCursor >= len(m.MemoryItems) {
+			m.MemoryCursor--
+		}
+	}
+}
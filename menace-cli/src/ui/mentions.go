@@ -0,0 +1,231 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxMentionSuggestions caps how many completions are listed under the input
+const MaxMentionSuggestions = 8
+
+// MaxMentionBytes is the largest file inlined whole, bigger files need a line range
+const MaxMentionBytes = 256 << 10
+
+// Matches "@path" or "@path:10-40" tokens that start a word
+var mentionPattern = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// Matches the optional ":start-end" or ":line" suffix of a mention
+var mentionRangePattern = regexp.MustCompile(`^(.+?):(\d+)(?:-(\d+))?$`)
+
+// fileMention is a resolved @path[:start-end] reference in the user's input
+type fileMention struct {
+	Path  string
+	Start int // 1-based, 0 means whole file
+	End   int
+}
+
+// Compact form shown in the transcript, e.g. "main.go:10-40"
+func (f fileMention) String() string {
+	switch {
+	case f.Start == 0:
+		return f.Path
+	case f.End == f.Start:
+		return fmt.Sprintf("%s:%d", f.Path, f.Start)
+	default:
+		return fmt.Sprintf("%s:%d-%d", f.Path, f.Start, f.End)
+	}
+}
+
+// parseMention resolves a token (without the "@") to an existing file.
+//
+// Returns false if the token isn't a readable file, so things like "@someone" are left alone.
+func parseMention(token string) (fileMention, bool) {
+	// Allow sentence punctuation straight after the mention
+	for _, candidate := range []string{token, strings.TrimRight(token, ".,;:!?)\"'")} {
+		mention := fileMention{Path: candidate}
+		if match := mentionRangePattern.FindStringSubmatch(candidate); match != nil {
+			mention.Path = match[1]
+			mention.Start, _ = strconv.Atoi(match[2])
+			mention.End = mention.Start
+			if match[3] != "" {
+				mention.End, _ = strconv.Atoi(match[3])
+			}
+			if mention.End < mention.Start {
+				mention.Start, mention.End = mention.End, mention.Start
+			}
+		}
+		if info, err := os.Stat(mention.Path); err == nil && !info.IsDir() {
+			return mention, true
+		}
+	}
+	return fileMention{}, false
+}
+
+// ExpandMentions inlines every @file mention in input as line-numbered file contents.
+//
+// Returns the text to send to the agent and the mentions that were found.
+// Mentions that can't be read are reported as errors and left as typed.
+func ExpandMentions(input string) (string, []fileMention, []error) {
+	var mentions []fileMention
+	var errs []error
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		mention, ok := parseMention(match[2])
+		if !ok || seen[mention.String()] {
+			continue
+		}
+		seen[mention.String()] = true
+		mentions = append(mentions, mention)
+	}
+	if len(mentions) == 0 {
+		return input, nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(input)
+	sb.WriteString("\n\nReferenced files (line numbers are 1-based):")
+	var found []fileMention
+	for _, mention := range mentions {
+		content, err := readMention(mention)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		found = append(found, mention)
+		sb.WriteString(fmt.Sprintf("\n\n<file path=%q>\n%s</file>", mention.String(), content))
+	}
+	if len(found) == 0 {
+		return input, nil, errs
+	}
+	return sb.String(), found, errs
+}
+
+// readMention returns the mentioned file, or line range, with line numbers
+func readMention(mention fileMention) (string, error) {
+	if info, err := os.Stat(mention.Path); err == nil && info.Size() > MaxMentionBytes && mention.Start == 0 {
+		return "", fmt.Errorf("%s is too large to inline, mention a line range instead (e.g. @%s:1-200)", mention.Path, mention.Path)
+	}
+	numbered, err := ReadFileWithLineNumbers(mention.Path)
+	if err != nil {
+		return "", err
+	}
+	if mention.Start == 0 {
+		return numbered, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(numbered, "\n"), "\n")
+	if mention.Start > len(lines) {
+		return "", fmt.Errorf("%s has only %d lines", mention.Path, len(lines))
+	}
+	end := mention.End
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return strings.Join(lines[mention.Start-1:end], "\n") + "\n", nil
+}
+
+// mentionLabel is the compact reference shown in the transcript instead of file contents
+func mentionLabel(mentions []fileMention) string {
+	labels := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		labels = append(labels, "📄 "+mention.String())
+	}
+	return strings.Join(labels, "  ")
+}
+
+// mentionAtCursor returns the partial "@path" token the cursor is at the end of.
+//
+// Returns the token without "@", its start column (of the "@") and whether there is one.
+func (m *Model) mentionAtCursor() (string, int, bool) {
+	lines := strings.Split(m.Input, "\n")
+	if m.CursorY >= len(lines) {
+		return "", 0, false
+	}
+	runes := []rune(lines[m.CursorY])
+	if m.CursorX > len(runes) {
+		return "", 0, false
+	}
+	start := m.CursorX
+	for start > 0 && runes[start-1] != ' ' && runes[start-1] != '\t' {
+		start--
+	}
+	// The cursor must be after the "@", not on it
+	if start >= m.CursorX || runes[start] != '@' {
+		return "", 0, false
+	}
+	return string(runes[start+1 : m.CursorX]), start, true
+}
+
+// CompleteMention completes the @path under the cursor against the file system.
+//
+// A single match is inserted directly (directories keep a trailing slash so Tab can continue),
+// several matches are narrowed to their common prefix and listed in MentionSuggestions.
+// Returns false if the cursor is not in a mention.
+func (m *Model) CompleteMention() bool {
+	token, start, ok := m.mentionAtCursor()
+	if !ok {
+		return false
+	}
+
+	dir, prefix := filepath.Split(token)
+	searchDir := dir
+	if searchDir == "" {
+		searchDir = "."
+	}
+	entries, err := os.ReadDir(searchDir)
+	if err != nil {
+		m.MentionSuggestions = nil
+		return true
+	}
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, dir+name)
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		m.MentionSuggestions = nil
+		return true
+	case 1:
+		m.MentionSuggestions = nil
+		m.replaceMentionToken(start, matches[0])
+		return true
+	}
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) > len(token) {
+		m.replaceMentionToken(start, common)
+	}
+	if len(matches) > MaxMentionSuggestions {
+		matches = append(matches[:MaxMentionSuggestions], fmt.Sprintf("… %d more", len(matches)-MaxMentionSuggestions))
+	}
+	m.MentionSuggestions = matches
+	return true
+}
+
+// replaceMentionToken swaps the partial token between the "@" at column start and the cursor for its completion
+func (m *Model) replaceMentionToken(start int, completion string) {
+	for n := m.CursorX - start - 1; n > 0; n-- {
+		m.HandleBackSpace()
+	}
+	for _, char := range completion {
+		m.InsertCharacter(string(char))
+	}
+}
@@ -1,6 +1,91 @@
 package ui
 
+import (
+	"errors"
+	"os/exec"
+	"time"
+)
+
+// MessageKind is what a transcript entry is, so rendering, copying and export can treat each kind differently
+type MessageKind int
+
+const (
+	KindUnknown     MessageKind = iota // a zero Message, rendered like a system notice
+	KindUser                           // what the user typed
+	KindAgent                          // prose from the model
+	KindExplanation                    // the model's reason for a command or function call
+	KindCommand                        // a shell command or function call about to run
+	KindOutput                         // what a command or function returned
+	KindDiff                           // a file change applied by the agent
+	KindError                          // a command, function or Menace itself failed
+	KindSystem                         // notices from Menace itself
+	KindThinking                       // placeholder while waiting for the model
+)
+
+// Sender groups kinds by who they come from: "user", "llm" or "system"
+func (k MessageKind) Sender() string {
+	switch k {
+	case KindUser:
+		return "user"
+	case KindAgent, KindExplanation:
+		return "llm"
+	}
+	return "system"
+}
+
+// CommandPayload is attached to KindCommand, KindOutput and KindError messages from shell commands
+type CommandPayload struct {
+	Command string
+	// ExitCode is -1 if the command hasn't finished or couldn't start
+	ExitCode int
+}
+
+// FunctionPayload is attached to messages from function calls
+type FunctionPayload struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// DiffPayload is attached to KindDiff messages
+type DiffPayload struct {
+	Path  string
+	Diffs []LineDiff
+}
+
+// FilePayload is attached to messages about a single file, such as ReadFileWithLineNumbers output
+type FilePayload struct {
+	Path string
+}
+
 type Message struct {
-	Sender  string // "user", "llm", or "system"
+	Kind    MessageKind
 	Content string
+	Time    time.Time
+	// Duration of the model request or command that produced the message, 0 if not timed
+	Duration time.Duration
+	// Payload is a *CommandPayload, *FunctionPayload, *DiffPayload, *FilePayload or nil
+	Payload interface{}
+	// Input is the raw text the user typed, kept for editing (user messages only)
+	Input string
+	// HistoryIndex is the agent history entry the message belongs to, 0 if none
+	HistoryIndex int
+	// Expanded shows a long output in full instead of its preview, see Collapsible
+	Expanded bool
+}
+
+// Sender is "user", "llm" or "system", see MessageKind.Sender
+func (msg Message) Sender() string {
+	return msg.Kind.Sender()
+}
+
+// exitCode extracts the exit code of a finished command, -1 if it couldn't run
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
 }
@@ -1,15 +1,17 @@
 package ui
 
 import (
+	"menace-go/config"
 	"menace-go/llmServer"
 	"os/exec"
 	"runtime"
 	"strings"
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/x/cellbuf"
 	"github.com/mattn/go-runewidth"
 )
 
@@ -33,14 +35,70 @@ type Model struct {
 	SelectionEndX   int
 	SelectionEndY   int
 	IsHighlighting  bool
+	// Vim keybindings for the input, see HandleVimKey
+	Vim VimState
+	// Active key bindings, see NewKeymap
+	keymap *Keymap
+	// Current theme name and the themes from the config, see SetTheme
+	theme  string
+	themes map[string]config.Theme
+
+	// Input undo history, see RecordEdit
+	undoStack      []editorState
+	redoStack      []editorState
+	lastEditTyping bool
+
+	// Ctrl+F search over the chat pane
+	Search TranscriptSearch
+	// Help page, see OpenHelp
+	Help HelpOverlay
+	// HideSidebar gives the chat the full width
+	HideSidebar bool
+	// ApprovalPolicy overrides which suggestions wait for approval, see needsApproval
+	ApprovalPolicy string
+	// Settings page state, shown while IsConfigOpen
+	Settings SettingsPage
+	// Merged user and project config, reloaded when the settings page saves
+	config *config.Config
+
+	// Selection in the chat pane, see HandleChatMouse
+	ChatSelection        ChatSelection
+	lastChatClick        time.Time
+	lastChatClickMessage int
 
 	// Thinking animation state
-	IsThinking   bool
-	ThinkingDots int
+	IsThinking      bool
+	ThinkingDots    int
+	ThinkingStarted time.Time
 
 	// Config page state
 	IsConfigOpen bool
 	ConfigCursor int // Index of selected model in config
+	// Pulls are the Ollama models being downloaded, by name
+	Pulls map[string]llmServer.OllamaProgress
+
+	// Memory page state
+	IsMemoryOpen bool
+	MemoryCursor int
+	MemoryItems  []llmServer.Memory
+
+	// Images attached to the next prompt
+	Attachments []llmServer.ImageAttachment
+	// Completions for the @file mention being typed
+	MentionSuggestions []string
+	// Selected entry in the slash command popup
+	CommandPopupCursor int
+	// Multiple-choice question from the askUser function, nil when none is open
+	PendingQuestion *llmServer.Question
+	// Selected option, len(PendingQuestion.Options) is "Other"
+	QuestionCursor int
+	// Edit-and-resend state, see EditMessage
+	IsEditingMessage    bool
+	EditingMessageIndex int
+	// Conversations abandoned by editing an earlier message
+	Branches []Branch
+	// Files changed by the agent, oldest first, for /undo
+	FileHistory []FileSnapshot
 
 	// Pending command state
 	PendingCommand          *CommandSuggestionMsg
@@ -58,15 +116,29 @@ func (m *Model) ClearState() {
 	m.CursorX = 0
 	m.CursorY = 0
 	m.Scroll = 0
+	m.ClearInputSelection()
+	m.undoStack = nil
+	m.redoStack = nil
+	if m.Vim.Enabled {
+		m.resetVimCommand()
+		m.Vim.Mode = VimInsert
+	}
 }
 
-// Resets window size and scroll position when terminal is resized.
+// Updates the window size when the terminal is resized.
 //
-// Returns new Model.
+// The line at the top of the chat stays there unless the chat was scrolled to the bottom.
 func (m *Model) ResizeWindow(msg tea.Msg) {
+	message, offset, anchored := m.anchorScroll()
 	m.Width = msg.(tea.WindowSizeMsg).Width
 	m.Height = msg.(tea.WindowSizeMsg).Height
 	m.Scroll = 0
+	if anchored {
+		m.restoreScroll(message, offset)
+	}
+	// Line numbers change with the wrap width
+	m.ClearChatSelection()
+	m.Search.Current = searchMatch{Line: -1}
 }
 
 // UpdateWindowStart ensures the input window is scrolled so the cursor is always visible (applies to all lines).
@@ -117,112 +189,100 @@ func (m *Model) InsertCharacter(character string) {
 	m.Input = strings.Join(lines, "\n")
 }
 
+// AddMessage appends a message to the chat history, stamping its time
+func (m *Model) AddMessage(msg Message) {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	m.Messages = append(m.Messages, msg)
+}
+
 // Adds a user message to the chat history
+//
+// The message is linked to the agent history entry it is about to become.
 func (m *Model) AddUserMessage(message string) {
-	m.Messages = append(m.Messages, Message{Sender: "user", Content: message})
+	m.AddMessage(Message{
+		Kind:         KindUser,
+		Content:      message,
+		Input:        message,
+		HistoryIndex: m.agent.HistoryLen(),
+	})
 }
 
 // Adds a system message to the model chat history
 func (m *Model) AddSystemMessage(message string) {
-	m.Messages = append(m.Messages, Message{Sender: "system", Content: message})
+	m.AddMessage(Message{Kind: KindSystem, Content: message})
+}
+
+// AddErrorMessage adds an error from Menace itself to the chat history
+func (m *Model) AddErrorMessage(err error) {
+	m.AddMessage(Message{Kind: KindError, Content: fmt.Sprintf("Error: %s", err)})
 }
 
 func (m *Model) AddAgentMessage(message string) {
-	m.Messages = append(m.Messages, Message{Sender: "llm", Content: message})
+	m.AddMessage(Message{Kind: KindAgent, Content: message, HistoryIndex: m.agent.HistoryLen() - 1})
+}
+
+// AddResponse adds part of the model's latest response, timed from when thinking started
+func (m *Model) AddResponse(kind MessageKind, content string) {
+	m.AddMessage(Message{
+		Kind:         kind,
+		Content:      content,
+		Duration:     time.Since(m.ThinkingStarted),
+		HistoryIndex: m.agent.HistoryLen() - 1,
+	})
+}
+
+// commandResultMessage describes how a shell command went
+func commandResultMessage(command string, output string, err error, duration time.Duration) Message {
+	msg := Message{
+		Kind:     KindOutput,
+		Content:  fmt.Sprintf("Output:\n%s", output),
+		Duration: duration,
+		Payload:  &CommandPayload{Command: command, ExitCode: exitCode(err)},
+	}
+	if err != nil {
+		msg.Kind = KindError
+		msg.Content = fmt.Sprintf("Error: %s", err)
+	}
+	return msg
+}
+
+// functionResultMessage describes how a function call went, applied diffs get their own kind
+func functionResultMessage(fnCall *FunctionCallMsg, output string, err error, duration time.Duration) Message {
+	msg := Message{
+		Kind:     KindOutput,
+		Content:  fmt.Sprintf("Output:\n%s", output),
+		Duration: duration,
+		Payload:  &FunctionPayload{Name: fnCall.Name, Args: fnCall.Args},
+	}
+	path, _ := fnCall.Args["path"].(string)
+	switch {
+	case err != nil:
+		msg.Kind = KindError
+		msg.Content = fmt.Sprintf("Error: %s", err)
+	case fnCall.Name == "CreateAndApplyDiffs":
+		msg.Kind = KindDiff
+		msg.Payload = &DiffPayload{Path: path, Diffs: lineDiffsFromArgs(fnCall.Args)}
+	case fnCall.Name == "ReadFileWithLineNumbers":
+		msg.Payload = &FilePayload{Path: path}
+	}
+	return msg
 }
 
 // Handle mouse scrolling
 func (m *Model) HandleScroll(direction int) {
 	if direction > 0 { // Scroll up
-		// Calculate how many lines fit (adjusted for chat frame and input height)
-		visible := m.Height - 7
-		if visible < 0 {
-			visible = 0
-		}
-		// Calculate wrap width for content lines
-		chatWidth := m.Width - 24
-		wrapWidth := chatWidth - 2 // account for ChatStyle padding
-		if wrapWidth < 1 {
-			wrapWidth = 1
-		}
-		// Count total lines across all messages after wrapping
-		totalLines := 0
-		for _, msg := range m.Messages {
-			for _, part := range strings.Split(msg.Content, "\n") {
-				wrapped := cellbuf.Wrap(part, wrapWidth, "")
-				totalLines += strings.Count(wrapped, "\n") + 1
-			}
-		}
-		maxOff := totalLines - visible
-		if maxOff < 0 {
-			maxOff = 0
-		}
-		if m.Scroll < maxOff {
-			m.Scroll++
-		}
+		m.ScrollBy(1)
 	} else { // Scroll down
-		if m.Scroll > 0 {
-			m.Scroll--
-		}
+		m.ScrollBy(-1)
 	}
 }
 
 // Handles backspace key press
 func (m *Model) HandleBackSpace() {
 	// If text is highlighted, delete all highlighted text
-	if m.IsHighlighting {
-		lines := strings.Split(m.Input, "\n")
-		var newLines []string
-
-		// Handle single line selection
-		if m.SelectionStartY == m.SelectionEndY {
-			line := lines[m.SelectionStartY]
-			runes := []rune(line)
-			start := m.SelectionStartX
-			end := m.SelectionEndX
-			if start > end {
-				start, end = end, start
-			}
-			if start < len(runes) {
-				if end > len(runes) {
-					end = len(runes)
-				}
-				newLine := string(runes[:start]) + string(runes[end:])
-				lines[m.SelectionStartY] = newLine
-			}
-		} else {
-			// Handle multi-line selection
-			// Keep lines before selection
-			newLines = append(newLines, lines[:m.SelectionStartY]...)
-
-			// Add first line up to selection start
-			if m.SelectionStartX < len([]rune(lines[m.SelectionStartY])) {
-				firstLine := lines[m.SelectionStartY]
-				newLines = append(newLines, string([]rune(firstLine)[:m.SelectionStartX]))
-			}
-
-			// Add last line from selection end
-			if m.SelectionEndX < len([]rune(lines[m.SelectionEndY])) {
-				lastLine := lines[m.SelectionEndY]
-				newLines = append(newLines, string([]rune(lastLine)[m.SelectionEndX:]))
-			}
-
-			// Add remaining lines after selection
-			if m.SelectionEndY+1 < len(lines) {
-				newLines = append(newLines, lines[m.SelectionEndY+1:]...)
-			}
-
-			lines = newLines
-		}
-
-		m.Input = strings.Join(lines, "\n")
-		m.CursorX = m.SelectionStartX
-		m.CursorY = m.SelectionStartY
-		m.IsHighlighting = false
-		m.SelectionStartX = 0
-		m.SelectionStartY = 0
-		m.SelectionEndX = 0
-		m.SelectionEndY = 0
+	if m.DeleteSelection() {
 		return
 	}
 
@@ -271,6 +331,9 @@ func (m *Model) HandleHorizontalCursorMovement(direction string) {
 
 // Handles delete key press
 func (m *Model) HandleDelete() {
+	if m.DeleteSelection() {
+		return
+	}
 	lines := strings.Split(m.Input, "\n")
 	runes := []rune(lines[m.CursorY])
 	if m.CursorX < len(runes) {
@@ -285,10 +348,18 @@ func (m *Model) HandleDelete() {
 	}
 }
 
+// mainWidth is the width of the chat and input boxes: the terminal minus margins, borders and the sidebar
+func (m *Model) mainWidth(termWidth int) int {
+	if m.HideSidebar {
+		return termWidth - 6
+	}
+	return termWidth - 24
+}
+
 // GetMaxInputWidth returns the maximum width of the input field.
 func (m *Model) GetMaxInputWidth() int {
 	prefix := "> "
-	boxW := m.Width - 24
+	boxW := m.mainWidth(m.Width)
 	prefixW := runewidth.StringWidth(prefix)
 	return boxW - 2 - prefixW
 }
@@ -328,16 +399,34 @@ func (m *Model) SelectAll() {
 		m.SelectionStartY = 0
 		m.SelectionEndX = len([]rune(lines[len(lines)-1]))
 		m.SelectionEndY = len(lines) - 1
+		m.CursorX = m.SelectionEndX
+		m.CursorY = m.SelectionEndY
 	}
 }
 
 // main entry point for the UI
-func NewModel(agent *llmServer.Agent) *Model {
-	return &Model{
+func NewModel(agent *llmServer.Agent, cfg *config.Config) *Model {
+	m := &Model{
 		CursorX: 0,
 		CursorY: 0,
 		agent:   agent,
 	}
+	m.SetVimMode(cfg.EditorMode == "vim")
+	m.applySettings(cfg)
+	m.themes = cfg.Themes
+	if err := m.SetTheme(cfg.Theme); err != nil {
+		m.AddSystemMessage("Theme: " + err.Error())
+		m.SetTheme(AutoTheme)
+	}
+	keymap, errs := NewKeymap(cfg.Keys)
+	m.keymap = keymap
+	for _, err := range errs {
+		m.AddSystemMessage("Key bindings: " + err.Error())
+	}
+	for _, err := range LoadCustomCommands() {
+		m.AddSystemMessage("Skipped custom command: " + err.Error())
+	}
+	return m
 }
 
 // GetSelectedText returns the currently selected text
@@ -345,63 +434,18 @@ func (m *Model) GetSelectedText() string {
 	if !m.IsHighlighting {
 		return ""
 	}
-
+	startX, startY, endX, endY := m.inputSelection()
 	lines := strings.Split(m.Input, "\n")
-	var selectedText strings.Builder
-
-	// Ensure we have valid line indices
-	if m.SelectionStartY >= len(lines) || m.SelectionEndY >= len(lines) {
-		return ""
+	runes := []rune(m.Input)
+	start := inputOffset(lines, startX, startY)
+	end := inputOffset(lines, endX, endY)
+	if end > len(runes) {
+		end = len(runes)
 	}
-
-	// Handle single line selection
-	if m.SelectionStartY == m.SelectionEndY {
-		line := lines[m.SelectionStartY]
-		runes := []rune(line)
-		start := m.SelectionStartX
-		end := m.SelectionEndX
-		if start > end {
-			start, end = end, start
-		}
-		if start < len(runes) {
-			if end > len(runes) {
-				end = len(runes)
-			}
-			return string(runes[start:end])
-		}
+	if start >= end {
 		return ""
 	}
-
-	// Handle multi-line selection
-	for y := m.SelectionStartY; y <= m.SelectionEndY; y++ {
-		line := lines[y]
-		runes := []rune(line)
-
-		if y == m.SelectionStartY {
-			// First line: from SelectionStartX to end
-			if m.SelectionStartX < len(runes) {
-				selectedText.WriteString(string(runes[m.SelectionStartX:]))
-			}
-		} else if y == m.SelectionEndY {
-			// Last line: from start to SelectionEndX
-			if m.SelectionEndX > 0 {
-				if m.SelectionEndX > len(runes) {
-					selectedText.WriteString(string(runes))
-				} else {
-					selectedText.WriteString(string(runes[:m.SelectionEndX]))
-				}
-			}
-		} else {
-			// Middle lines: entire line
-			selectedText.WriteString(line)
-		}
-
-		if y < m.SelectionEndY {
-			selectedText.WriteString("\n")
-		}
-	}
-
-	return selectedText.String()
+	return string(runes[start:end])
 }
 
 // CopyToClipboard copies the given text to the system clipboard
@@ -439,58 +483,7 @@ func (m *Model) CutSelectedText() {
 	m.CopyToClipboard(selectedText)
 
 	// Delete the selected text
-	lines := strings.Split(m.Input, "\n")
-	var newLines []string
-
-	// Handle single line selection
-	if m.SelectionStartY == m.SelectionEndY {
-		line := lines[m.SelectionStartY]
-		runes := []rune(line)
-		start := m.SelectionStartX
-		end := m.SelectionEndX
-		if start > end {
-			start, end = end, start
-		}
-		if start < len(runes) {
-			if end > len(runes) {
-				end = len(runes)
-			}
-			newLine := string(runes[:start]) + string(runes[end:])
-			lines[m.SelectionStartY] = newLine
-		}
-	} else {
-		// Handle multi-line selection
-		// Keep lines before selection
-		newLines = append(newLines, lines[:m.SelectionStartY]...)
-
-		// Add first line up to selection start
-		if m.SelectionStartX < len([]rune(lines[m.SelectionStartY])) {
-			firstLine := lines[m.SelectionStartY]
-			newLines = append(newLines, string([]rune(firstLine)[:m.SelectionStartX]))
-		}
-
-		// Add last line from selection end
-		if m.SelectionEndX < len([]rune(lines[m.SelectionEndY])) {
-			lastLine := lines[m.SelectionEndY]
-			newLines = append(newLines, string([]rune(lastLine)[m.SelectionEndX:]))
-		}
-
-		// Add remaining lines after selection
-		if m.SelectionEndY+1 < len(lines) {
-			newLines = append(newLines, lines[m.SelectionEndY+1:]...)
-		}
-
-		lines = newLines
-	}
-
-	m.Input = strings.Join(lines, "\n")
-	m.CursorX = m.SelectionStartX
-	m.CursorY = m.SelectionStartY
-	m.IsHighlighting = false
-	m.SelectionStartX = 0
-	m.SelectionStartY = 0
-	m.SelectionEndX = 0
-	m.SelectionEndY = 0
+	m.DeleteSelection()
 }
 
 // GetClipboardContent returns the content of the system clipboard
@@ -514,16 +507,61 @@ func (m *Model) GetClipboardContent() string {
 	return string(output)
 }
 
-// Helper function to send a message to the agent and get a response. To be integrated in future
-func (m *Model) AIChat(msg string) tea.Msg {
-	response, cmdSuggestion, err := m.agent.SendMessage(context.Background(), msg)
-	if err != nil {
+// Sends a message to the agent and turns the response into the matching tea.Msg.
+//
+// Meant to be run inside a tea.Cmd, the result re-enters Update.
+// If the agent had to retry malformed blocks, the result is wrapped in a RetriedResponseMsg.
+func (m *Model) AIChat(msg string, images ...llmServer.ImageAttachment) tea.Msg {
+	response, err := m.agent.SendMessage(context.Background(), msg, images...)
+	if err != nil && response == nil {
 		return SystemMessage{Content: "Error: " + err.Error()}
 	}
-	if cmdSuggestion != nil {
-		return CommandSuggestionMsg{Command: cmdSuggestion.Command, Reason: cmdSuggestion.Reason}
+
+	var result tea.Msg
+	var parseErr *llmServer.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		result = MalformedResponseMsg{Content: response.Text, Err: parseErr}
+	case err != nil:
+		result = SystemMessage{Content: "Error: " + err.Error()}
+	case response.Command != nil:
+		result = CommandSuggestionMsg{
+			Command:                 response.Command.Command,
+			Reason:                  response.Command.Reason,
+			AwaitingCommandApproval: response.Command.AwaitingCommandApproval,
+			Narrative:               response.Command.Narrative,
+		}
+	case response.Function != nil:
+		result = FunctionCallMsg{
+			Name:                    response.Function.Name,
+			Reason:                  response.Function.Reason,
+			AwaitingCommandApproval: response.Function.AwaitingCommandApproval,
+			Args:                    response.Function.Args,
+			Narrative:               response.Function.Narrative,
+		}
+	default:
+		result = LLMResponseMsg{Content: response.Text}
 	}
-	return LLMResponseMsg{Content: response}
+
+	if len(response.FailedAttempts) > 0 {
+		return RetriedResponseMsg{Attempts: response.FailedAttempts, Result: result}
+	}
+	return result
+}
+
+// SendToAgent shows shown as the user's message and sends prompt to the agent in the background.
+//
+// Used by slash commands that expand into a longer prompt than what the user typed.
+func (m *Model) SendToAgent(shown string, prompt string) tea.Cmd {
+	// Without a HistoryIndex the message can't be edited, resending shown wouldn't send prompt
+	m.AddMessage(Message{Kind: KindUser, Content: shown, Input: shown})
+	m.StartThinking()
+	return tea.Batch(
+		func() tea.Msg {
+			return m.AIChat(prompt)
+		},
+		thinkingTick(),
+	)
 }
 
 func (m *Model) ExecuteFunctionCall(fnCall *FunctionCallMsg) (string, error) {
@@ -536,7 +574,7 @@ func (m *Model) ExecuteFunctionCall(fnCall *FunctionCallMsg) (string, error) {
 		summary, _ := m.PendingFunctionCall.Args["summary"].(string)
 		err = llmServer.CreatePullRequest(branchName, title, summary)
 		if err != nil {
-			m.AddSystemMessage(fmt.Sprintf("Error: %s", err))
+			m.AddErrorMessage(err)
 			m.agent.AddToMessageChain(fmt.Sprintf("Oops! An error occured. Error: %s. Please fix this and try again", err), "")
 			output = "Error: " + err.Error()
 		} else {
@@ -547,30 +585,67 @@ func (m *Model) ExecuteFunctionCall(fnCall *FunctionCallMsg) (string, error) {
 		output, err = ReadFileWithLineNumbers(path)
 	case "CreateAndApplyDiffs":
 		path, _ := m.PendingFunctionCall.Args["path"].(string)
-		diffsRaw, _ := m.PendingFunctionCall.Args["diffs"].([]interface{})
-		var diffs []LineDiff
-		for _, d := range diffsRaw {
-			if diffMap, ok := d.(map[string]interface{}); ok {
-				diff := LineDiff{}
-				if t, ok := diffMap["Type"].(float64); ok {
-					diff.Type = DiffType(int(t))
-				}
-				if idx, ok := diffMap["LineIndex"].(float64); ok {
-					diff.LineIndex = int(idx)
-				}
-				if oldC, ok := diffMap["OldContent"].(string); ok {
-					diff.OldContent = oldC
-				}
-				if newC, ok := diffMap["NewContent"].(string); ok {
-					diff.NewContent = newC
-				}
-				diffs = append(diffs, diff)
-			}
-		}
+		diffs := lineDiffsFromArgs(m.PendingFunctionCall.Args)
+		// Keep the old contents around for /undo
+		m.FileHistory = append(m.FileHistory, snapshotFile(path))
 		err = CreateAndApplyDiffs(path, diffs)
 		if err == nil {
 			output = "Diffs applied successfully."
+		} else {
+			m.FileHistory = m.FileHistory[:len(m.FileHistory)-1]
+		}
+	case "remember":
+		content, _ := m.PendingFunctionCall.Args["content"].(string)
+		scope, _ := m.PendingFunctionCall.Args["scope"].(string)
+		var memory llmServer.Memory
+		memory, err = m.agent.Remember(scope, content)
+		if err == nil {
+			output = fmt.Sprintf("Remembered [%s] (%s) %s", memory.ID, memory.Scope, memory.Content)
+		}
+	case "recall":
+		query, _ := m.PendingFunctionCall.Args["query"].(string)
+		var memories []llmServer.Memory
+		memories, err = m.agent.Recall(query)
+		if err == nil {
+			output = llmServer.FormatMemories(memories)
+			if output == "" {
+				output = "No matching memories."
+			}
+		}
+	case "forget":
+		id, _ := m.PendingFunctionCall.Args["id"].(string)
+		var found bool
+		found, err = m.agent.Forget(id)
+		if err == nil && !found {
+			err = fmt.Errorf("no memory with id %q", id)
+		} else if err == nil {
+			output = "Forgot " + id
 		}
 	}
 	return output, err
 }
+
+// lineDiffsFromArgs reads the "diffs" argument of a CreateAndApplyDiffs call
+func lineDiffsFromArgs(args map[string]interface{}) []LineDiff {
+	diffsRaw, _ := args["diffs"].([]interface{})
+	var diffs []LineDiff
+	for _, d := range diffsRaw {
+		if diffMap, ok := d.(map[string]interface{}); ok {
+			diff := LineDiff{}
+			if t, ok := diffMap["Type"].(float64); ok {
+				diff.Type = DiffType(int(t))
+			}
+			if idx, ok := diffMap["LineIndex"].(float64); ok {
+				diff.LineIndex = int(idx)
+			}
+			if oldC, ok := diffMap["OldContent"].(string); ok {
+				diff.OldContent = oldC
+			}
+			if newC, ok := diffMap["NewContent"].(string); ok {
+				diff.NewContent = newC
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
@@ -1,90 +1,301 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
+	"menace-go/llmServer"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
-	zone "github.com/lrstanley/bubblezone"
+	"github.com/mattn/go-runewidth"
 )
 
 type ModelInfo struct {
 	Provider string
 	ID       string
+	// ContextSize is the context window in tokens, 0 if unknown
+	ContextSize int
+	// Size, Quantization, ParameterSize and Modified are only known for Ollama models
+	Size          int64
+	Quantization  string
+	ParameterSize string
+	Modified      time.Time
 }
 
 var ClosedSourceModels = map[string]ModelInfo{
-	"GPT 4.1": {Provider: "openai", ID: "gpt-4-0125-preview"},
-	"GPT 3.5": {Provider: "openai", ID: "gpt-3.5-turbo"},
-	"o4-mini": {Provider: "openai", ID: "o4-mini-2025-04-16"},
-	"Claude":  {Provider: "anthropic", ID: "claude-3-opus-20240229"},
+	"GPT 4.1": {Provider: "openai", ID: "gpt-4-0125-preview", ContextSize: 128000},
+	"GPT 3.5": {Provider: "openai", ID: "gpt-3.5-turbo", ContextSize: 16385},
+	"o4-mini": {Provider: "openai", ID: "o4-mini-2025-04-16", ContextSize: 200000},
+	"Claude":  {Provider: "anthropic", ID: "claude-3-opus-20240229", ContextSize: 200000},
 }
 
+// ModelKeys are the names of AvailableModels grouped by provider in providerOrder, then sorted by name
 var ModelKeys = []string{}
 
 var AvailableModels = map[string]ModelInfo{}
 
-func (m *Model) ConfigView(termHeight, termWidth int) string {
-	var configContent strings.Builder
-	configContent.WriteString(HeaderStyle.Render("Select Model") + "\n\n")
+// providerOrder is the order of the provider groups in the model picker, unknown providers go last
+var providerOrder = []string{"openai", "anthropic", "ollama"}
 
-	for i, model := range ModelKeys {
-		style := lipgloss.NewStyle()
+// providerTitles are the group headers of the model picker
+var providerTitles = map[string]string{
+	"openai":    "OpenAI",
+	"anthropic": "Anthropic",
+	"ollama":    "Ollama",
+}
+
+// providerRank is the position of provider in providerOrder
+func providerRank(provider string) int {
+	for i, p := range providerOrder {
+		if p == provider {
+			return i
+		}
+	}
+	return len(providerOrder)
+}
+
+// fuzzyScore matches the runes of query in order anywhere in text, ignoring case.
+//
+// Consecutive runes and runes at the start of a word score higher, ok is false if query doesn't match.
+func fuzzyScore(query string, text string) (score int, ok bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(strings.ToLower(text))
+	qi := 0
+	last := -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if ti == last+1 {
+			score += 4
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 2
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// filteredModels is the model picker's list: ModelKeys matching the typed filter,
+// still grouped by provider but with the best matches first in each group
+func (m *Model) filteredModels() []string {
+	if m.Settings.Filter == "" {
+		return ModelKeys
+	}
+	scores := map[string]int{}
+	matches := []string{}
+	for _, name := range ModelKeys {
+		nameScore, nameOk := fuzzyScore(m.Settings.Filter, name)
+		idScore, idOk := fuzzyScore(m.Settings.Filter, AvailableModels[name].ID)
+		if !nameOk && !idOk {
+			continue
+		}
+		if !nameOk || idOk && idScore > nameScore {
+			nameScore = idScore
+		}
+		scores[name] = nameScore
+		matches = append(matches, name)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := AvailableModels[matches[i]], AvailableModels[matches[j]]
+		if a.Provider != b.Provider {
+			return providerRank(a.Provider) < providerRank(b.Provider)
+		}
+		return scores[matches[i]] > scores[matches[j]]
+	})
+	return matches
+}
+
+// isCurrentModel is true if name is the model the agent is using
+func (m *Model) isCurrentModel(name string) bool {
+	info := AvailableModels[name]
+	return info.ID == m.agent.Model && info.Provider == m.agent.Provider()
+}
+
+// formatContextSize shortens a context window size, "?" if unknown
+func formatContextSize(tokens int) string {
+	switch {
+	case tokens == 0:
+		return "?"
+	case tokens >= 1000:
+		return fmt.Sprintf("%dk", tokens/1000)
+	}
+	return fmt.Sprint(tokens)
+}
+
+// formatModelPrice is a model's input/output price per million tokens
+func formatModelPrice(info ModelInfo) string {
+	price, ok := llmServer.PriceFor(info.Provider, info.ID)
+	switch {
+	case !ok:
+		return "price unknown"
+	case price == llmServer.ModelPrice{}:
+		return "free"
+	}
+	return fmt.Sprintf("$%.2f/$%.2f per 1M", price.Input, price.Output)
+}
+
+// modelList is the model tab of the settings page: the filter and the models grouped by provider,
+// showing at most rows lines of models around the cursor
+func (m *Model) modelList(rows int) string {
+	var list strings.Builder
+	if m.Settings.Filter != "" {
+		list.WriteString(QuestionStyle.Render("Filter: ") + m.Settings.Filter + CursorStyle.Render(" ") + "\n\n")
+	} else {
+		list.WriteString(CommandPopupStyle.Render("Type to filter, ● is the current model") + "\n\n")
+	}
+
+	models := m.filteredModels()
+	nameWidth := 0
+	for _, name := range models {
+		nameWidth = max(nameWidth, runewidth.StringWidth(name))
+	}
+
+	var lines []string
+	cursorLine := 0
+	provider := ""
+	for i, name := range models {
+		info := AvailableModels[name]
+		if info.Provider != provider {
+			provider = info.Provider
+			lines = append(lines, providerHeader(provider))
+		}
+		marker := "  "
+		if m.isCurrentModel(name) {
+			marker = "● "
+		}
+		contextSize := info.ContextSize
+		badge := "[cloud]"
+		if info.Provider == "ollama" {
+			// The configured context window is the one in effect
+			if numCtx := m.config.Ollama.Models[info.ID].NumCtx; numCtx > 0 {
+				contextSize = numCtx
+			}
+			badge = "[local] " + formatBytes(info.Size) + " " + info.Quantization + " " + info.ParameterSize + " · " + formatAge(info.Modified)
+		}
+		details := fmt.Sprintf("%6s ctx  %-22s %s", formatContextSize(contextSize), formatModelPrice(info), badge)
+		label := "  " + marker + runewidth.FillRight(name, nameWidth)
 		if i == m.ConfigCursor {
-			style = style.
-				Foreground(lipgloss.Color("#8be9fd")).
-				Bold(true)
+			label = MenuSelectedStyle.Render("> " + marker + runewidth.FillRight(name, nameWidth))
+			cursorLine = len(lines)
 		}
-		configContent.WriteString(style.Render("> "+model) + "\n")
+		lines = append(lines, label+"  "+CommandPopupStyle.Render(details))
+	}
+	if len(models) == 0 {
+		lines = append(lines, "No model matches \""+m.Settings.Filter+"\", "+m.keymap.KeyHelp(ActionModelPull)+" pulls it from Ollama")
+	}
+	// Say why there are no Ollama models
+	if provider != "ollama" && m.Settings.Filter == "" {
+		lines = append(lines, providerHeader("ollama"))
+		status := ollamaStatus
+		if status == "" {
+			status = "No models installed, type a name and press " + m.keymap.KeyHelp(ActionModelPull) + " to pull one"
+		}
+		lines = append(lines, "  "+CommandPopupStyle.Render(status))
 	}
 
-	configContent.WriteString("\n" + HeaderStyle.Render("Controls:"))
-	configContent.WriteString("\n↑/↓: Navigate")
-	configContent.WriteString("\nEnter: Select")
-	configContent.WriteString("\nEsc: Back")
+	// Keep the cursor in view when there are more models than rows
+	rows = max(rows-len(m.Pulls), 3)
+	start := 0
+	if len(lines) > rows {
+		start = min(max(cursorLine-rows/2, 0), len(lines)-rows)
+	}
+	end := min(start+rows, len(lines))
+	list.WriteString(strings.Join(lines[start:end], "\n") + "\n")
+	if start > 0 || end < len(lines) {
+		list.WriteString(CommandPopupStyle.Render(fmt.Sprintf("%d of %d models", len(models), len(ModelKeys))) + "\n")
+	}
 
-	configBox := lipgloss.NewStyle().
-		Width(termWidth - 24).
-		Height(termHeight - 5).
-		Padding(1).
-		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("12")).
-		Render(configContent.String())
+	for _, name := range m.pullNames() {
+		list.WriteString(renderPullProgress(name, m.Pulls[name]) + "\n")
+	}
+	return list.String()
+}
 
-	return zone.Scan(lipgloss.NewStyle().
-		Margin(0, 2).
-		Render(configBox))
+// providerHeader heads a provider's group in the model picker, Ollama's shows the server address
+func providerHeader(provider string) string {
+	title := providerTitles[provider]
+	if title == "" {
+		title = provider
+	}
+	if provider == "ollama" {
+		return SectionHeaderStyle.Render(title) + "  " + CommandPopupStyle.Render(llmServer.OllamaHost())
+	}
+	return SectionHeaderStyle.Render(title)
 }
 
-// OpenConfig opens the config page
-func (m *Model) OpenConfig() {
+// OpenConfig opens the settings page on the model tab with the cursor on the current model.
+//
+// Ollama models are refreshed in the background.
+func (m *Model) OpenConfig() tea.Cmd {
 	m.IsConfigOpen = true
 	m.ConfigCursor = 0
+	m.Settings = SettingsPage{}
+	loadAvailableModels()
+	for i, name := range ModelKeys {
+		if m.isCurrentModel(name) {
+			m.ConfigCursor = i
+		}
+	}
+	return listOllamaModels("")
+}
 
-	// run shell script called "ollama list" and get the output
+// loadAvailableModels fills AvailableModels and ModelKeys with the closed source models and the last listed Ollama models
+func loadAvailableModels() {
 	AvailableModels = make(map[string]ModelInfo)
 	for model := range ClosedSourceModels {
 		AvailableModels[model] = ClosedSourceModels[model]
 	}
-	ollamas, ollamaErr := runShellCommand("ollama list")
-	if ollamaErr == nil {
-		for _, ollama := range strings.Split(ollamas, "\n") {
-			if !strings.Contains(ollama, "NAME") && ollama != "" {
-				modelName := strings.Split(ollama, "  ")[0]
-				AvailableModels[strings.Split(modelName, ":")[0]] = ModelInfo{Provider: "ollama", ID: modelName}
-			}
-		}
+	// Keyed by the full tag, llama3:8b and llama3:70b are different models
+	for _, model := range ollamaModels {
+		AvailableModels[model.ID] = model
 	}
 	ModelKeys = make([]string, 0, len(AvailableModels))
 	for model := range AvailableModels {
 		ModelKeys = append(ModelKeys, model)
 	}
+	sort.Slice(ModelKeys, func(i, j int) bool {
+		a, b := AvailableModels[ModelKeys[i]], AvailableModels[ModelKeys[j]]
+		if a.Provider != b.Provider {
+			return providerRank(a.Provider) < providerRank(b.Provider)
+		}
+		return strings.ToLower(ModelKeys[i]) < strings.ToLower(ModelKeys[j])
+	})
+}
+
+// findModel looks up a model by name or ID, Ollama tags can be left out for the latest one like ollama run
+func findModel(name string) (string, bool) {
+	for _, key := range ModelKeys {
+		if strings.EqualFold(key, name) || strings.EqualFold(AvailableModels[key].ID, name) || strings.EqualFold(key, name+":latest") {
+			return key, true
+		}
+	}
+	return "", false
 }
 
-// CloseConfig closes the config page
+// selectedModel is the model under the picker's cursor, "" if nothing matches the filter
+func (m *Model) selectedModel() string {
+	models := m.filteredModels()
+	if m.ConfigCursor >= len(models) {
+		return ""
+	}
+	return models[m.ConfigCursor]
+}
+
+// CloseConfig closes the settings page
 func (m *Model) CloseConfig() {
 	m.IsConfigOpen = false
 	m.ConfigCursor = 0
+	m.Settings = SettingsPage{}
 }
 
 // HandleConfigNavigation handles up/down navigation in config page
@@ -98,23 +309,45 @@ func (m *Model) HandleConfigNavigation(direction string) {
 			m.ConfigCursor--
 		}
 	} else if direction == tea.KeyDown.String() {
-		if m.ConfigCursor < len(AvailableModels)-1 {
+		if m.ConfigCursor < len(m.filteredModels())-1 {
 			m.ConfigCursor++
 		}
 	}
 }
 
-// SelectModel selects the current model in config
+// SetModelFilter changes the model picker's filter, moving the cursor to the first match
+func (m *Model) SetModelFilter(filter string) {
+	m.Settings.Filter = filter
+	m.ConfigCursor = 0
+}
+
+// SelectModel switches to the model selected in the settings page and saves it as the startup model
 func (m *Model) SelectModel() {
 	if !m.IsConfigOpen {
 		return
 	}
+	name := m.selectedModel()
+	if name == "" {
+		return
+	}
+	modelInfo := AvailableModels[name]
+	path := m.settingsPath(false)
+	m.SwitchModel(name)
+	if m.agent.Model != modelInfo.ID {
+		return
+	}
+	if err := m.saveConfig(path, map[string]interface{}{"provider": modelInfo.Provider, "model": modelInfo.ID}); err != nil {
+		m.AddErrorMessage(fmt.Errorf("saving the model: %v", err))
+		return
+	}
+	m.AddSystemMessage("Saved as the startup model in " + path)
+}
 
-	selectedModel := ModelKeys[m.ConfigCursor]
-
+// SwitchModel switches the agent to one of AvailableModels by its display name
+func (m *Model) SwitchModel(selectedModel string) {
 	modelInfo, exists := AvailableModels[selectedModel]
 	if !exists {
-		m.AddSystemMessage("Error: Invalid model selected")
+		m.AddErrorMessage(errors.New("invalid model selected"))
 		m.CloseConfig()
 		return
 	}
@@ -126,7 +359,7 @@ func (m *Model) SelectModel() {
 		modelInfo.Provider == "ollama",
 	)
 	if err != nil {
-		m.AddSystemMessage("Error switching model: " + err.Error())
+		m.AddErrorMessage(fmt.Errorf("switching model: %v", err))
 		m.CloseConfig()
 		return
 	}
@@ -0,0 +1,401 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"menace-go/config"
+	"menace-go/llmServer"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// OllamaModelsMsg carries the models installed on the Ollama server
+type OllamaModelsMsg struct {
+	Models []ModelInfo
+	Err    error
+	// SwitchTo is the model /model asked for, switched to once the list is in
+	SwitchTo string
+}
+
+// OllamaPullMsg is a progress update of a model pull, the last one has Done set
+type OllamaPullMsg struct {
+	Name     string
+	Progress llmServer.OllamaProgress
+	Done     bool
+	Err      error
+	updates  <-chan OllamaPullMsg
+}
+
+// OllamaDeleteMsg reports the outcome of deleting a model
+type OllamaDeleteMsg struct {
+	Name string
+	Err  error
+}
+
+// OllamaShowMsg carries the details of the model being inspected
+type OllamaShowMsg struct {
+	Name string
+	Info llmServer.OllamaModelInfo
+	Err  error
+}
+
+// ollamaTimeout bounds every request to the Ollama server except pulls
+const ollamaTimeout = 10 * time.Second
+
+// ollamaShowWorkers is how many models' details are fetched at once when listing
+const ollamaShowWorkers = 4
+
+var (
+	// ollamaModels are the models from the last listing, shown until the next one arrives
+	ollamaModels []ModelInfo
+	// ollamaStatus is why ollamaModels is empty, "" once the server answered
+	ollamaStatus = "loading…"
+)
+
+// listOllamaModels asks the Ollama server for its models without blocking the UI
+func listOllamaModels(switchTo string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+		defer cancel()
+		models, err := llmServer.ListOllamaModels(ctx)
+		if err != nil {
+			return OllamaModelsMsg{Err: err, SwitchTo: switchTo}
+		}
+		infos := make([]ModelInfo, 0, len(models))
+		for _, model := range models {
+			info := ModelInfo{
+				Provider:      "ollama",
+				ID:            model.Name,
+				Size:          model.Size,
+				Quantization:  model.Details.QuantizationLevel,
+				ParameterSize: model.Details.ParameterSize,
+				Modified:      model.ModifiedAt,
+			}
+			infos = append(infos, info)
+		}
+
+		// Only a model's details have its context length, fetch them in parallel
+		var wg sync.WaitGroup
+		workers := make(chan struct{}, ollamaShowWorkers)
+		for i := range infos {
+			wg.Add(1)
+			go func(info *ModelInfo) {
+				defer wg.Done()
+				workers <- struct{}{}
+				defer func() { <-workers }()
+				ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+				defer cancel()
+				if details, err := llmServer.ShowOllamaModel(ctx, info.ID); err == nil {
+					info.ContextSize = details.ContextLength
+				}
+			}(&infos[i])
+		}
+		wg.Wait()
+		return OllamaModelsMsg{Models: infos, SwitchTo: switchTo}
+	}
+}
+
+// HandleOllamaModels puts a new Ollama listing into the model picker, keeping the selection
+func (m *Model) HandleOllamaModels(msg OllamaModelsMsg) {
+	selected := m.selectedModel()
+	if msg.Err != nil {
+		ollamaModels = nil
+		ollamaStatus = msg.Err.Error()
+	} else {
+		ollamaModels = msg.Models
+		ollamaStatus = ""
+	}
+	loadAvailableModels()
+	for i, name := range m.filteredModels() {
+		if name == selected {
+			m.ConfigCursor = i
+		}
+	}
+	m.ConfigCursor = max(min(m.ConfigCursor, len(m.filteredModels())-1), 0)
+
+	if msg.SwitchTo == "" {
+		return
+	}
+	if name, ok := findModel(msg.SwitchTo); ok {
+		m.SwitchModel(name)
+		return
+	}
+	m.AddSystemMessage("Unknown model: " + msg.SwitchTo + ". Available: " + strings.Join(ModelKeys, ", "))
+}
+
+// pullOllamaModel starts downloading a model, progress arrives as OllamaPullMsg
+func (m *Model) pullOllamaModel(name string) tea.Cmd {
+	if _, ok := m.Pulls[name]; ok {
+		m.reportModelStatus("Already pulling "+name, true)
+		return nil
+	}
+	if m.Pulls == nil {
+		m.Pulls = map[string]llmServer.OllamaProgress{}
+	}
+	m.Pulls[name] = llmServer.OllamaProgress{Status: "starting"}
+	m.reportModelStatus("Pulling "+name, false)
+
+	updates := make(chan OllamaPullMsg)
+	go func() {
+		err := llmServer.PullOllamaModel(context.Background(), name, func(progress llmServer.OllamaProgress) {
+			updates <- OllamaPullMsg{Name: name, Progress: progress}
+		})
+		updates <- OllamaPullMsg{Name: name, Done: true, Err: err}
+		close(updates)
+	}()
+	return waitForPull(updates)
+}
+
+// pullNames are the models being pulled, sorted
+func (m *Model) pullNames() []string {
+	names := make([]string, 0, len(m.Pulls))
+	for name := range m.Pulls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitForPull delivers the next progress update of a pull
+func waitForPull(updates <-chan OllamaPullMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg := <-updates
+		msg.updates = updates
+		return msg
+	}
+}
+
+// HandleOllamaPull records pull progress, refreshing the model list when the pull finishes
+func (m *Model) HandleOllamaPull(msg OllamaPullMsg) tea.Cmd {
+	if !msg.Done {
+		m.Pulls[msg.Name] = msg.Progress
+		return waitForPull(msg.updates)
+	}
+	delete(m.Pulls, msg.Name)
+	if msg.Err != nil {
+		m.reportModelStatus(fmt.Sprintf("Pulling %s failed: %v", msg.Name, msg.Err), true)
+		return nil
+	}
+	m.reportModelStatus("Pulled "+msg.Name, false)
+	return listOllamaModels("")
+}
+
+// deleteOllamaModel removes a model from the Ollama server
+func deleteOllamaModel(name string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+		defer cancel()
+		return OllamaDeleteMsg{Name: name, Err: llmServer.DeleteOllamaModel(ctx, name)}
+	}
+}
+
+// HandleOllamaDelete reports a deleted model and refreshes the model list
+func (m *Model) HandleOllamaDelete(msg OllamaDeleteMsg) tea.Cmd {
+	if msg.Err != nil {
+		m.reportModelStatus(fmt.Sprintf("Deleting %s failed: %v", msg.Name, msg.Err), true)
+		return nil
+	}
+	m.reportModelStatus("Deleted "+msg.Name, false)
+	return listOllamaModels("")
+}
+
+// showOllamaModel fetches the details of a model for the inspect view
+func showOllamaModel(name string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), ollamaTimeout)
+		defer cancel()
+		info, err := llmServer.ShowOllamaModel(ctx, name)
+		return OllamaShowMsg{Name: name, Info: info, Err: err}
+	}
+}
+
+// HandleOllamaShow fills in the inspect view, unless another model is inspected by now
+func (m *Model) HandleOllamaShow(msg OllamaShowMsg) {
+	if m.Settings.Inspect != msg.Name {
+		return
+	}
+	if msg.Err != nil {
+		m.Settings.Status = msg.Err.Error()
+		m.Settings.Failed = true
+		return
+	}
+	m.Settings.InspectInfo = &msg.Info
+}
+
+// reportModelStatus shows the outcome of a model operation on the settings page, or in the chat once it's closed
+func (m *Model) reportModelStatus(status string, failed bool) {
+	if m.IsConfigOpen {
+		m.Settings.Status = status
+		m.Settings.Failed = failed
+		return
+	}
+	if failed {
+		m.AddErrorMessage(fmt.Errorf("%s", status))
+	} else {
+		m.AddSystemMessage(status)
+	}
+}
+
+// setOllamaOptions changes the runtime options of an Ollama model for the agent,
+// reloading the model if it's in use
+func (m *Model) setOllamaOptions(name string, change func(options *config.OllamaOptions)) error {
+	models := map[string]config.OllamaOptions{}
+	for model, options := range m.config.Ollama.Models {
+		models[model] = options
+	}
+	options := models[name]
+	change(&options)
+	models[name] = options
+	m.agent.SetOllamaOptions(models)
+	if m.agent.Provider() == "ollama" && m.agent.Model == name {
+		return m.agent.ReloadModel()
+	}
+	return nil
+}
+
+// ollamaOptionSettings are the runtime options of an Ollama model, edited in the inspect view
+func ollamaOptionSettings(name string) []setting {
+	path := func(option string) []string {
+		// Model tags contain dots, so the key can't be dotted
+		return []string{"ollama", "models", name, option}
+	}
+	return []setting{
+		{
+			Label: "Context size",
+			Path:  path("num_ctx"),
+			Help:  "num_ctx, the context window in tokens. Empty for the server's default",
+			Value: func(m *Model) string {
+				if numCtx := m.config.Ollama.Models[name].NumCtx; numCtx > 0 {
+					return strconv.Itoa(numCtx)
+				}
+				return ""
+			},
+			Apply: func(m *Model, value string) (interface{}, error) {
+				numCtx := 0
+				if value != "" {
+					var err error
+					numCtx, err = strconv.Atoi(value)
+					if err != nil || numCtx < 1 {
+						return nil, fmt.Errorf("the context size must be a whole number above 0")
+					}
+				}
+				if err := m.setOllamaOptions(name, func(options *config.OllamaOptions) { options.NumCtx = numCtx }); err != nil {
+					return nil, err
+				}
+				if numCtx == 0 {
+					return nil, nil
+				}
+				return numCtx, nil
+			},
+		},
+		{
+			Label: "Keep alive",
+			Path:  path("keep_alive"),
+			Help:  "How long the model stays loaded after a request, e.g. 10m, or -1m to keep it loaded. Empty for 5m",
+			Value: func(m *Model) string { return m.config.Ollama.Models[name].KeepAlive },
+			Apply: func(m *Model, value string) (interface{}, error) {
+				if value != "" {
+					if _, err := time.ParseDuration(value); err != nil {
+						return nil, fmt.Errorf("keep alive must be a duration such as 10m or 1h")
+					}
+				}
+				if err := m.setOllamaOptions(name, func(options *config.OllamaOptions) { options.KeepAlive = value }); err != nil {
+					return nil, err
+				}
+				if value == "" {
+					return nil, nil
+				}
+				return value, nil
+			},
+		},
+	}
+}
+
+// ollamaDetails is the top of the inspect view: what the server knows about the model
+func (m *Model) ollamaDetails() string {
+	name := m.Settings.Inspect
+	var sb strings.Builder
+	sb.WriteString(SectionHeaderStyle.Render(name) + "\n")
+	info := m.Settings.InspectInfo
+	if info == nil {
+		if !m.Settings.Failed {
+			sb.WriteString(CommandPopupStyle.Render("loading…") + "\n")
+		}
+		return sb.String() + "\n"
+	}
+
+	model := AvailableModels[name]
+	facts := []string{}
+	if info.Details.Family != "" {
+		facts = append(facts, info.Details.Family)
+	}
+	if info.Details.ParameterSize != "" {
+		facts = append(facts, info.Details.ParameterSize+" parameters")
+	}
+	if info.Details.QuantizationLevel != "" {
+		facts = append(facts, info.Details.QuantizationLevel)
+	}
+	if model.Size > 0 {
+		facts = append(facts, formatBytes(model.Size), "modified "+formatAge(model.Modified))
+	}
+	sb.WriteString("  " + strings.Join(facts, " · ") + "\n")
+	sb.WriteString("  Context length " + formatContextSize(info.ContextLength))
+	if len(info.Capabilities) > 0 {
+		sb.WriteString(" · " + strings.Join(info.Capabilities, ", "))
+	}
+	sb.WriteString("\n")
+	if info.Parameters != "" {
+		sb.WriteString(CommandPopupStyle.Render("  Defaults:") + "\n")
+		for _, line := range strings.Split(info.Parameters, "\n") {
+			sb.WriteString("    " + strings.Join(strings.Fields(line), " ") + "\n")
+		}
+	}
+	if license, _, _ := strings.Cut(info.License, "\n"); license != "" {
+		sb.WriteString(CommandPopupStyle.Render("  License: "+license) + "\n")
+	}
+	return sb.String() + "\n" + SectionHeaderStyle.Render("Runtime options") + "\n"
+}
+
+// renderPullProgress is a progress bar for a model being pulled
+func renderPullProgress(name string, progress llmServer.OllamaProgress) string {
+	const barWidth = 20
+	line := "  ↓ " + name + "  "
+	if progress.Total > 0 {
+		// The server can report more completed than total, e.g. after a retried chunk
+		completed := min(max(progress.Completed, 0), progress.Total)
+		filled := int(barWidth * completed / progress.Total)
+		line += "[" + strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled) + "] " +
+			fmt.Sprintf("%3d%% of %s  ", 100*completed/progress.Total, formatBytes(progress.Total))
+	}
+	return line + CommandPopupStyle.Render(progress.Status)
+}
+
+// formatBytes is a size in GB, MB or KB
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(size)/1e9)
+	case size >= 1e6:
+		return fmt.Sprintf("%.0f MB", float64(size)/1e6)
+	}
+	return fmt.Sprintf("%.0f KB", float64(size)/1e3)
+}
+
+// formatAge is how long ago t was, e.g. "3d ago"
+func formatAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	case age < 60*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+	return t.Format("2006-01-02")
+}
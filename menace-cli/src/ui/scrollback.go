@@ -0,0 +1,327 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/mattn/go-runewidth"
+)
+
+// TranscriptSearch is the state of the Ctrl+F search over the chat pane
+type TranscriptSearch struct {
+	// Open is true while the search bar is shown
+	Open bool
+	// Typing is true while keys edit the query, otherwise n/N move between matches
+	Typing bool
+	Query  string
+	// Current is the match that was jumped to, Line -1 for none
+	Current searchMatch
+}
+
+// searchMatch is a query match in the rendered transcript, in line and cell coordinates
+type searchMatch struct {
+	Line  int
+	Col   int
+	Width int
+}
+
+// maxScroll is the largest scroll offset that still fills the chat pane
+func (m *Model) maxScroll() int {
+	lines, _, visible := m.chatLayout()
+	if len(lines) <= visible {
+		return 0
+	}
+	return len(lines) - visible
+}
+
+// ScrollBy moves the chat view by n lines, positive scrolls up towards older messages
+func (m *Model) ScrollBy(n int) {
+	m.Scroll += n
+	if maxOff := m.maxScroll(); m.Scroll > maxOff {
+		m.Scroll = maxOff
+	}
+	if m.Scroll < 0 {
+		m.Scroll = 0
+	}
+}
+
+// scrollToLine scrolls so transcript line y is the top visible line, or as close as possible
+func (m *Model) scrollToLine(y int) {
+	lines, _, visible := m.chatLayout()
+	m.Scroll = 0
+	m.ScrollBy(len(lines) - visible - y)
+}
+
+// JumpToUserMessage scrolls to the previous (direction < 0) or next user message above or below the top of the view
+func (m *Model) JumpToUserMessage(direction int) {
+	lines, start, _ := m.chatLayout()
+	target := -1
+	for y, line := range lines {
+		// Only the first line of each message
+		if m.Messages[line.Message].Kind != KindUser || (y > 0 && lines[y-1].Message == line.Message) {
+			continue
+		}
+		if direction < 0 && y < start {
+			target = y
+		}
+		if direction > 0 && y > start {
+			target = y
+			break
+		}
+	}
+	if target < 0 {
+		if direction > 0 {
+			m.Scroll = 0
+		}
+		return
+	}
+	m.scrollToLine(target)
+}
+
+// scrollPage is how far PgUp/PgDn move, a screen less one line of overlap.
+// It lays out the whole transcript, so only call it for those keys.
+func (m *Model) scrollPage() int {
+	_, _, visible := m.chatLayout()
+	if visible > 2 {
+		return visible - 1
+	}
+	return 1
+}
+
+// HandleScrollKey handles the scrollback keys, returns true if key was one of them
+func (m *Model) HandleScrollKey(key string) bool {
+	switch action := m.keymap.Action(ScopeInput, key); action {
+	case ActionPageUp:
+		m.ScrollBy(m.scrollPage())
+	case ActionPageDown:
+		m.ScrollBy(-m.scrollPage())
+	case ActionScrollTop:
+		m.Scroll = m.maxScroll()
+	case ActionScrollBottom:
+		m.Scroll = 0
+	case ActionPrevMessage:
+		m.JumpToUserMessage(-1)
+	case ActionNextMessage:
+		m.JumpToUserMessage(1)
+	case ActionSearch:
+		m.Search = TranscriptSearch{Open: true, Typing: true, Current: searchMatch{Line: -1}}
+	case ActionToggleOutput:
+		return m.ToggleLatestCollapse()
+	case ActionLineStart, ActionLineEnd:
+		// The line keys belong to the input while there is something in it
+		if m.Input != "" {
+			return false
+		}
+		if action == ActionLineStart {
+			m.Scroll = m.maxScroll()
+		} else {
+			m.Scroll = 0
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// anchorScroll records which message line is at the top of the view, so resizing can keep it there
+func (m *Model) anchorScroll() (message int, offset int, ok bool) {
+	if m.Scroll == 0 {
+		return 0, 0, false
+	}
+	lines, start, _ := m.chatLayout()
+	if start >= len(lines) {
+		return 0, 0, false
+	}
+	message = lines[start].Message
+	for y := start; y > 0 && lines[y-1].Message == message; y-- {
+		offset++
+	}
+	return message, offset, true
+}
+
+// restoreScroll scrolls back to a line recorded by anchorScroll after the layout changed
+func (m *Model) restoreScroll(message int, offset int) {
+	lines, _, _ := m.chatLayout()
+	for y, line := range lines {
+		if line.Message == message {
+			last := y
+			for last+1 < len(lines) && lines[last+1].Message == message {
+				last++
+			}
+			if y+offset > last {
+				offset = last - y
+			}
+			m.scrollToLine(y + offset)
+			return
+		}
+	}
+}
+
+// searchMatches finds the query in every rendered line, ignoring case
+func searchMatches(lines []chatLine, query string) []searchMatch {
+	if query == "" {
+		return nil
+	}
+	query = strings.ToLower(query)
+	width := runewidth.StringWidth(query)
+	var matches []searchMatch
+	for y, line := range lines {
+		plain := strings.ToLower(ansi.Strip(line.Rendered))
+		offset := 0
+		for {
+			i := strings.Index(plain[offset:], query)
+			if i < 0 {
+				break
+			}
+			col := runewidth.StringWidth(plain[:offset+i])
+			if col >= line.Indent {
+				matches = append(matches, searchMatch{Line: y, Col: col, Width: width})
+			}
+			offset += i + len(query)
+		}
+	}
+	return matches
+}
+
+// jumpToMatch moves to the next (direction > 0, towards older lines) or previous match
+// from the current one and scrolls it into view
+func (m *Model) jumpToMatch(direction int) {
+	lines, start, visible := m.chatLayout()
+	matches := searchMatches(lines, m.Search.Query)
+	if len(matches) == 0 {
+		m.Search.Current = searchMatch{Line: -1}
+		return
+	}
+
+	// Searching starts at the bottom of the view and moves up, like a pager's ?
+	current := m.Search.Current
+	if current.Line < 0 {
+		current = searchMatch{Line: start + visible, Col: 0}
+	}
+	next := -1
+	if direction > 0 {
+		for i := len(matches) - 1; i >= 0; i-- {
+			if matches[i].Line < current.Line || (matches[i].Line == current.Line && matches[i].Col < current.Col) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			next = len(matches) - 1
+		}
+	} else {
+		for i, match := range matches {
+			if match.Line > current.Line || (match.Line == current.Line && match.Col > current.Col) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			next = 0
+		}
+	}
+	m.Search.Current = matches[next]
+
+	// Center the match unless it is already visible
+	if y := matches[next].Line; y < start || y >= start+visible {
+		m.scrollToLine(y - visible/2)
+	}
+}
+
+// HandleSearchKey handles keys while the search bar is open, returns false for keys that should
+// reach the input instead
+func (m *Model) HandleSearchKey(msg tea.KeyMsg) bool {
+	key := msg.String()
+	// While typing, letters are part of the query
+	text := msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace
+	action := m.keymap.Action(ScopeSearch, key)
+	if m.Search.Typing && text {
+		action = ""
+	}
+	switch action {
+	case ActionSearchClose:
+		m.Search = TranscriptSearch{}
+		return true
+	case ActionSearchOlder:
+		m.jumpToMatch(1)
+		return true
+	case ActionSearchNewer:
+		m.jumpToMatch(-1)
+		return true
+	}
+
+	if !m.Search.Typing {
+		if action != ActionSearchEdit {
+			// Anything else goes back to the input
+			m.Search = TranscriptSearch{}
+			return false
+		}
+		m.Search.Typing = true
+		return true
+	}
+
+	switch {
+	case action == ActionSearchDone:
+		m.Search.Typing = false
+	case msg.Type == tea.KeyBackspace:
+		if runes := []rune(m.Search.Query); len(runes) > 0 {
+			m.Search.Query = string(runes[:len(runes)-1])
+		}
+		m.Search.Current = searchMatch{Line: -1}
+		m.jumpToMatch(1)
+	case text && !msg.Paste:
+		m.Search.Query += string(msg.Runes)
+		// Incremental: search again from the bottom of the view on every keystroke
+		m.Search.Current = searchMatch{Line: -1}
+		m.jumpToMatch(1)
+	}
+	return true
+}
+
+// highlightSearchMatches marks query matches on transcript line y
+func (m Model) highlightSearchMatches(y int, chat chatLine) string {
+	line := chat.Rendered
+	if !m.Search.Open || m.Search.Query == "" {
+		return line
+	}
+	matches := searchMatches([]chatLine{chat}, m.Search.Query)
+	// Work right to left so earlier columns stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		match := matches[i]
+		style := SearchMatchStyle
+		if m.Search.Current.Line == y && m.Search.Current.Col == match.Col {
+			style = SearchCurrentStyle
+		}
+		width := ansi.StringWidth(line)
+		line = ansi.Cut(line, 0, match.Col) +
+			style.Render(ansi.Strip(ansi.Cut(line, match.Col, match.Col+match.Width))) +
+			ansi.Cut(line, match.Col+match.Width, width)
+	}
+	return line
+}
+
+// renderSearchBar draws the search query and match count above the input
+func (m Model) renderSearchBar(lines []chatLine) string {
+	matches := searchMatches(lines, m.Search.Query)
+	status := "no matches"
+	if len(matches) > 0 {
+		status = fmt.Sprintf("%d matches", len(matches))
+		for i, match := range matches {
+			if match == m.Search.Current {
+				status = fmt.Sprintf("%d/%d", len(matches)-i, len(matches))
+			}
+		}
+	}
+	k := m.keymap
+	help := k.ShortHelp(ActionSearchDone) + ": done  " + k.ShortHelp(ActionSearchClose) + ": close"
+	query := m.Search.Query
+	if m.Search.Typing {
+		query += CursorStyle.Render(" ")
+	} else {
+		help = k.ShortHelp(ActionSearchOlder) + "/" + k.ShortHelp(ActionSearchNewer) + ": older/newer  " +
+			k.ShortHelp(ActionSearchEdit) + ": edit  " + k.ShortHelp(ActionSearchClose) + ": close"
+	}
+	return QuestionStyle.Render("Search: ") + query + "  " + CommandPopupStyle.Render("("+status+")  "+help)
+}
@@ -0,0 +1,733 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/config"
+	"menace-go/llmServer"
+	"os"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	zone "github.com/lrstanley/bubblezone"
+	"github.com/mattn/go-runewidth"
+)
+
+// Approval policies, see needsApproval
+const (
+	// ApprovalAgent lets the agent decide what needs approval
+	ApprovalAgent = "agent"
+	// ApprovalAlways makes every command and function call wait for approval
+	ApprovalAlways = "always"
+	// ApprovalNever runs everything without asking
+	ApprovalNever = "never"
+)
+
+// needsApproval applies the approval policy to the agent's own choice
+func (m *Model) needsApproval(suggested bool) bool {
+	switch m.ApprovalPolicy {
+	case ApprovalAlways:
+		return true
+	case ApprovalNever:
+		return false
+	}
+	return suggested
+}
+
+// SettingsPage is the state of the settings page opened with the sidebar's config button
+type SettingsPage struct {
+	Tab    int
+	Cursor int
+	// Editing is true while keys type into Input, the new value of the selected setting
+	Editing bool
+	Input   string
+	// Project saves changes to the project config instead of the user config
+	Project bool
+	// Status is the outcome of the last change, Failed marks it as an error
+	Status string
+	Failed bool
+	// Filter narrows the model picker to models fuzzily matching it
+	Filter string
+	// Inspect is the Ollama model whose details and options replace the model picker,
+	// InspectInfo is nil until the server answers
+	Inspect     string
+	InspectInfo *llmServer.OllamaModelInfo
+	// ConfirmDelete is the Ollama model deleted if the delete key is pressed again
+	ConfirmDelete string
+}
+
+type settingKind int
+
+const (
+	settingText settingKind = iota
+	// settingSecret is a text setting that is never shown in full
+	settingSecret
+	// settingChoice cycles through Choices
+	settingChoice
+)
+
+// setting is one editable value on the settings page
+type setting struct {
+	Label string
+	// Key is the config key, dotted for nested values, see config.Set
+	Key string
+	// Path replaces Key for keys containing dots, see config.SetPath
+	Path []string
+	Kind settingKind
+	// UserOnly settings are always saved to the user config, API keys don't belong in a repository
+	UserOnly bool
+	Help     string
+	Choices  func(m *Model) []string
+	// Value is the value in effect, "" for the default
+	Value func(m *Model) string
+	// Apply validates value and puts it into effect, returning what to store in the config, nil to remove the key
+	Apply func(m *Model, value string) (interface{}, error)
+	// Default is stored instead of removing the key from the project config,
+	// where removing it would bring back the user config's value
+	Default interface{}
+}
+
+// settingsTab is one tab of the settings page, the model picker has no settings
+type settingsTab struct {
+	Title    string
+	Settings []setting
+}
+
+// settingsTabs is the settings page, filled in init because settings call back into the Model
+var settingsTabs []settingsTab
+
+func init() {
+	settingsTabs = []settingsTab{
+		{Title: "Model"},
+		{Title: "Keys", Settings: []setting{
+			apiKeySetting("openai", "OpenAI API key"),
+			apiKeySetting("anthropic", "Anthropic API key"),
+		}},
+		{Title: "Approval", Settings: []setting{{
+			Label: "Approval policy",
+			Key:   "approval_policy",
+			Kind:  settingChoice,
+			Help:  "agent: the agent decides what needs approval, always: every command and file change waits for you, never: nothing waits",
+			Choices: func(m *Model) []string {
+				return []string{ApprovalAgent, ApprovalAlways, ApprovalNever}
+			},
+			Value: func(m *Model) string { return m.ApprovalPolicy },
+			Apply: func(m *Model, value string) (interface{}, error) {
+				m.ApprovalPolicy = value
+				if value == ApprovalAgent {
+					return nil, nil
+				}
+				return value, nil
+			},
+			Default: ApprovalAgent,
+		}}},
+		{Title: "Generation", Settings: []setting{
+			{
+				Label: "Temperature",
+				Key:   "generation.temperature",
+				Help:  "0 to 2, empty for the default of 1 (OpenAI's reasoning models only accept 1)",
+				Value: func(m *Model) string {
+					if m.config.Generation.Temperature == nil {
+						return ""
+					}
+					return strconv.FormatFloat(*m.config.Generation.Temperature, 'f', -1, 64)
+				},
+				Apply: func(m *Model, value string) (interface{}, error) {
+					generation := m.config.Generation
+					generation.Temperature = nil
+					if value != "" {
+						temperature, err := strconv.ParseFloat(value, 64)
+						if err != nil || temperature < 0 || temperature > 2 {
+							return nil, fmt.Errorf("temperature must be a number from 0 to 2")
+						}
+						generation.Temperature = &temperature
+					}
+					m.agent.SetGeneration(generation)
+					if generation.Temperature == nil {
+						return nil, nil
+					}
+					return *generation.Temperature, nil
+				},
+				Default: 1.0,
+			},
+			{
+				Label: "Max tokens",
+				Key:   "generation.max_tokens",
+				Help:  "Longest response in tokens, empty for the provider's default",
+				Value: func(m *Model) string {
+					if m.config.Generation.MaxTokens == nil || *m.config.Generation.MaxTokens == 0 {
+						return ""
+					}
+					return strconv.Itoa(*m.config.Generation.MaxTokens)
+				},
+				Apply: func(m *Model, value string) (interface{}, error) {
+					generation := m.config.Generation
+					generation.MaxTokens = nil
+					if value != "" {
+						maxTokens, err := strconv.Atoi(value)
+						if err != nil || maxTokens < 1 {
+							return nil, fmt.Errorf("max tokens must be a whole number above 0")
+						}
+						generation.MaxTokens = &maxTokens
+					}
+					m.agent.SetGeneration(generation)
+					if generation.MaxTokens == nil {
+						return nil, nil
+					}
+					return *generation.MaxTokens, nil
+				},
+				Default: 0,
+			},
+		}},
+		{Title: "Appearance", Settings: []setting{
+			{
+				Label:   "Theme",
+				Key:     "theme",
+				Kind:    settingChoice,
+				Help:    "auto follows the terminal background, add your own in the \"themes\" section of the config",
+				Choices: func(m *Model) []string { return ThemeNames(m.themes) },
+				Value:   func(m *Model) string { return m.theme },
+				Apply: func(m *Model, value string) (interface{}, error) {
+					if err := m.SetTheme(value); err != nil {
+						return nil, err
+					}
+					if value == AutoTheme {
+						return nil, nil
+					}
+					return value, nil
+				},
+				Default: AutoTheme,
+			},
+			{
+				Label:   "Sidebar",
+				Key:     "sidebar",
+				Kind:    settingChoice,
+				Help:    "Without the sidebar, open help and settings with /help and /settings",
+				Choices: func(m *Model) []string { return []string{"on", "off"} },
+				Value: func(m *Model) string {
+					if m.HideSidebar {
+						return "off"
+					}
+					return "on"
+				},
+				Apply: func(m *Model, value string) (interface{}, error) {
+					m.HideSidebar = value == "off"
+					if m.HideSidebar {
+						return false, nil
+					}
+					return nil, nil
+				},
+				Default: true,
+			},
+			{
+				Label:   "Vim mode",
+				Key:     "editor_mode",
+				Kind:    settingChoice,
+				Help:    "Vim keybindings for the input",
+				Choices: func(m *Model) []string { return []string{"off", "on"} },
+				Value: func(m *Model) string {
+					if m.Vim.Enabled {
+						return "on"
+					}
+					return "off"
+				},
+				Apply: func(m *Model, value string) (interface{}, error) {
+					m.SetVimMode(value == "on")
+					if m.Vim.Enabled {
+						return "vim", nil
+					}
+					return nil, nil
+				},
+				Default: "default",
+			},
+		}},
+		{Title: "Shell", Settings: []setting{{
+			Label: "Shell",
+			Key:   "shell",
+			Help:  "Runs approved commands, e.g. bash, zsh or pwsh. Empty for sh (cmd on Windows)",
+			Value: func(m *Model) string { return commandShell },
+			Apply: func(m *Model, value string) (interface{}, error) {
+				if value == config.DefaultShell {
+					value = ""
+				}
+				if err := SetCommandShell(value); err != nil {
+					return nil, err
+				}
+				// The agent writes commands for this shell
+				m.agent.SetShell(value)
+				if value == "" {
+					return nil, nil
+				}
+				return value, nil
+			},
+			Default: config.DefaultShell,
+		}}},
+		{Title: "Ollama", Settings: []setting{{
+			Label: "Ollama host",
+			Key:   "ollama.host",
+			Help:  "Where the Ollama server runs, e.g. http://192.168.1.20:11434. Empty for 127.0.0.1:11434, " + llmServer.OllamaHostEnv + " takes precedence at startup",
+			Value: func(m *Model) string { return os.Getenv(llmServer.OllamaHostEnv) },
+			Apply: func(m *Model, value string) (interface{}, error) {
+				if strings.ContainsAny(value, " \t\n") {
+					return nil, fmt.Errorf("the host can't contain spaces")
+				}
+				if value == "" {
+					os.Unsetenv(llmServer.OllamaHostEnv)
+				} else {
+					os.Setenv(llmServer.OllamaHostEnv, value)
+				}
+				if m.agent.Provider() == "ollama" {
+					if err := m.agent.ReloadModel(); err != nil {
+						return nil, err
+					}
+				}
+				if value == "" {
+					return nil, nil
+				}
+				return value, nil
+			},
+			Default: "http://127.0.0.1:11434",
+		}}},
+	}
+}
+
+// apiKeySetting edits a provider's API key, applied through its environment variable
+func apiKeySetting(provider string, label string) setting {
+	env := llmServer.APIKeyEnv[provider]
+	return setting{
+		Label:    label,
+		Key:      "api_keys." + provider,
+		Kind:     settingSecret,
+		UserOnly: true,
+		Help:     "Saved to the user config only, " + env + " takes precedence at startup",
+		Value:    func(m *Model) string { return os.Getenv(env) },
+		Apply: func(m *Model, value string) (interface{}, error) {
+			if strings.ContainsAny(value, " \t\n") {
+				return nil, fmt.Errorf("API keys can't contain spaces")
+			}
+			if value == "" {
+				os.Unsetenv(env)
+			} else {
+				os.Setenv(env, value)
+			}
+			if m.agent.Provider() == provider {
+				if err := m.agent.ReloadModel(); err != nil {
+					return nil, err
+				}
+			}
+			if value == "" {
+				return nil, nil
+			}
+			return value, nil
+		},
+	}
+}
+
+// maskSecret shows just enough of a key to tell keys apart
+func maskSecret(secret string) string {
+	runes := []rune(secret)
+	if len(runes) <= 8 {
+		return strings.Repeat("•", len(runes))
+	}
+	return string(runes[:3]) + "…" + string(runes[len(runes)-4:])
+}
+
+// settingsTabZone is the bubblezone ID of settings tab i
+func settingsTabZone(i int) string {
+	return fmt.Sprintf("settings-tab-%d", i)
+}
+
+// settingsPath is the config file changes to s are saved to
+func (m *Model) settingsPath(userOnly bool) string {
+	if m.Settings.Project && !userOnly {
+		return config.ProjectFile()
+	}
+	return config.UserFile()
+}
+
+// changeSetting validates, applies and saves a new value for s
+func (m *Model) changeSetting(s setting, value string) {
+	stored, err := s.Apply(m, strings.TrimSpace(value))
+	if err != nil {
+		m.Settings.Status = s.Label + ": " + err.Error()
+		m.Settings.Failed = true
+		return
+	}
+	keys := s.Path
+	if keys == nil {
+		keys = strings.Split(s.Key, ".")
+	}
+	path := m.settingsPath(s.UserOnly)
+	if stored == nil && path == config.ProjectFile() {
+		stored = s.Default
+	}
+	if err := m.saveConfigPath(path, keys, stored); err != nil {
+		m.Settings.Status = s.Label + " applied for this session only: " + err.Error()
+		m.Settings.Failed = true
+		return
+	}
+	m.Settings.Status = s.Label + " saved to " + path
+	m.Settings.Failed = false
+	if path == config.UserFile() && config.IsSetPath(config.ProjectFile(), keys) {
+		m.Settings.Status += ", the project config overrides it in this project"
+	}
+}
+
+// saveConfig writes values by config key to the config file at path and reloads the config
+func (m *Model) saveConfig(path string, values map[string]interface{}) error {
+	for key, value := range values {
+		if err := config.Set(path, key, value); err != nil {
+			return err
+		}
+	}
+	return m.reloadConfig()
+}
+
+// saveConfigPath writes one value to the config file at path, see config.SetPath, and reloads the config
+func (m *Model) saveConfigPath(path string, keys []string, value interface{}) error {
+	if err := config.SetPath(path, keys, value); err != nil {
+		return err
+	}
+	return m.reloadConfig()
+}
+
+// reloadConfig reads the config files again after a change.
+//
+// The merged settings are put back into effect, a value saved to one config file
+// may be overridden by the other and the session should match what is on disk.
+func (m *Model) reloadConfig() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	m.themes = cfg.Themes
+	m.agent.SetOllamaOptions(cfg.Ollama.Models)
+	m.agent.SetGeneration(cfg.Generation)
+	m.applySettings(cfg)
+	m.agent.SetShell(commandShell)
+	if vim := cfg.EditorMode == "vim"; vim != m.Vim.Enabled {
+		m.SetVimMode(vim)
+	}
+	if theme := cfg.Theme; theme != m.theme && !(theme == "" && m.theme == AutoTheme) {
+		if err := m.SetTheme(theme); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySettings puts the settings from the config into effect at startup, reporting invalid ones
+func (m *Model) applySettings(cfg *config.Config) {
+	m.config = cfg
+	switch cfg.ApprovalPolicy {
+	case "":
+		m.ApprovalPolicy = ApprovalAgent
+	case ApprovalAgent, ApprovalAlways, ApprovalNever:
+		m.ApprovalPolicy = cfg.ApprovalPolicy
+	default:
+		m.ApprovalPolicy = ApprovalAgent
+		m.AddSystemMessage("Unknown approval_policy " + cfg.ApprovalPolicy + ", expected always or never")
+	}
+	m.HideSidebar = cfg.Sidebar != nil && !*cfg.Sidebar
+	if err := SetCommandShell(cfg.Shell); err != nil {
+		m.agent.SetShell("")
+		m.AddSystemMessage("Shell: " + err.Error() + ", using the default")
+	}
+}
+
+// switchSettingsTab moves to the next (1) or previous (-1) tab, refreshing Ollama models when it's the model tab
+func (m *Model) switchSettingsTab(direction int) tea.Cmd {
+	m.Settings.Tab = (m.Settings.Tab + direction + len(settingsTabs)) % len(settingsTabs)
+	m.Settings.Cursor = 0
+	m.closeInspect()
+	if m.Settings.Tab == 0 {
+		return listOllamaModels("")
+	}
+	return nil
+}
+
+// currentSettingsTab is the tab on screen, an inspected Ollama model's options replace the model picker
+func (m *Model) currentSettingsTab() settingsTab {
+	if m.Settings.Inspect != "" {
+		return settingsTab{Title: m.Settings.Inspect, Settings: ollamaOptionSettings(m.Settings.Inspect)}
+	}
+	return settingsTabs[m.Settings.Tab]
+}
+
+// closeInspect goes back from an Ollama model's details to the model picker
+func (m *Model) closeInspect() {
+	if m.Settings.Inspect == "" {
+		return
+	}
+	m.Settings.Inspect = ""
+	m.Settings.InspectInfo = nil
+	m.Settings.Cursor = 0
+	m.Settings.Editing = false
+}
+
+// HandleSettingsKey handles key presses while the settings page is open
+func (m *Model) HandleSettingsKey(msg tea.KeyMsg) tea.Cmd {
+	action := m.keymap.Action(ScopeMenu, msg.String())
+	tab := m.currentSettingsTab()
+	if m.Settings.Editing {
+		s := tab.Settings[m.Settings.Cursor]
+		switch {
+		case action == ActionMenuSelect:
+			m.Settings.Editing = false
+			m.changeSetting(s, m.Settings.Input)
+			m.Settings.Input = ""
+		case action == ActionMenuClose:
+			m.Settings.Editing = false
+			m.Settings.Input = ""
+		case msg.Type == tea.KeyBackspace:
+			if runes := []rune(m.Settings.Input); len(runes) > 0 {
+				m.Settings.Input = string(runes[:len(runes)-1])
+			}
+		case m.keymap.Matches(msg.String(), ActionDeleteToLineStart):
+			m.Settings.Input = ""
+		case msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace:
+			// Pasting is the usual way to enter an API key
+			m.Settings.Input += string(msg.Runes)
+		}
+		return nil
+	}
+
+	switch action {
+	case ActionMenuClose:
+		// Esc leaves a model's details and clears the model filter before closing the page
+		if m.Settings.Inspect != "" {
+			m.closeInspect()
+			return nil
+		}
+		if len(tab.Settings) == 0 && m.Settings.Filter != "" {
+			m.SetModelFilter("")
+			return nil
+		}
+		m.CloseConfig()
+		return nil
+	case ActionMenuNextTab:
+		return m.switchSettingsTab(1)
+	case ActionMenuPrevTab:
+		return m.switchSettingsTab(-1)
+	case ActionSettingsTarget:
+		m.Settings.Project = !m.Settings.Project
+		return nil
+	}
+
+	// The model tab is the model picker, typing filters it
+	if len(tab.Settings) == 0 {
+		confirmDelete := m.Settings.ConfirmDelete
+		m.Settings.ConfirmDelete = ""
+		switch {
+		case action == ActionModelPull:
+			return m.pullFromPicker()
+		case action == ActionModelDelete:
+			return m.deleteFromPicker(confirmDelete)
+		case action == ActionModelInspect:
+			return m.inspectFromPicker()
+		case action == ActionMenuSelect:
+			m.SelectModel()
+		case action == ActionMenuUp:
+			m.HandleConfigNavigation(tea.KeyUp.String())
+		case action == ActionMenuDown:
+			m.HandleConfigNavigation(tea.KeyDown.String())
+		case msg.Type == tea.KeyBackspace:
+			if runes := []rune(m.Settings.Filter); len(runes) > 0 {
+				m.SetModelFilter(string(runes[:len(runes)-1]))
+			}
+		case m.keymap.Matches(msg.String(), ActionDeleteToLineStart):
+			m.SetModelFilter("")
+		case (msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace) && !msg.Paste:
+			m.SetModelFilter(m.Settings.Filter + string(msg.Runes))
+		}
+		return nil
+	}
+
+	switch action {
+	case ActionMenuUp:
+		if m.Settings.Cursor > 0 {
+			m.Settings.Cursor--
+		}
+	case ActionMenuDown:
+		if m.Settings.Cursor < len(tab.Settings)-1 {
+			m.Settings.Cursor++
+		}
+	case ActionMenuSelect:
+		s := tab.Settings[m.Settings.Cursor]
+		switch s.Kind {
+		case settingChoice:
+			choices := s.Choices(m)
+			next := choices[0]
+			for i, choice := range choices {
+				if choice == s.Value(m) && i+1 < len(choices) {
+					next = choices[i+1]
+				}
+			}
+			m.changeSetting(s, next)
+		case settingSecret:
+			// Keys are typed from scratch rather than shown for editing
+			m.Settings.Editing = true
+			m.Settings.Input = ""
+		default:
+			m.Settings.Editing = true
+			m.Settings.Input = s.Value(m)
+		}
+	}
+	return nil
+}
+
+// pullFromPicker pulls the Ollama model named in the filter, or updates the selected one
+func (m *Model) pullFromPicker() tea.Cmd {
+	name := strings.TrimSpace(m.Settings.Filter)
+	if selected := m.selectedModel(); name == "" && AvailableModels[selected].Provider == "ollama" {
+		name = selected
+	}
+	if name == "" {
+		m.Settings.Status = "Type the name of an Ollama model to pull, e.g. llama3.2:3b"
+		m.Settings.Failed = true
+		return nil
+	}
+	m.SetModelFilter("")
+	return m.pullOllamaModel(name)
+}
+
+// deleteFromPicker deletes the selected Ollama model once confirmed by pressing the key twice
+func (m *Model) deleteFromPicker(confirmed string) tea.Cmd {
+	selected := m.selectedModel()
+	if AvailableModels[selected].Provider != "ollama" {
+		m.Settings.Status = "Only Ollama models can be deleted"
+		m.Settings.Failed = true
+		return nil
+	}
+	if confirmed != selected {
+		m.Settings.ConfirmDelete = selected
+		m.Settings.Status = "Press " + m.keymap.KeyHelp(ActionModelDelete) + " again to delete " + selected
+		m.Settings.Failed = true
+		return nil
+	}
+	m.Settings.Status = "Deleting " + selected
+	m.Settings.Failed = false
+	return deleteOllamaModel(selected)
+}
+
+// inspectFromPicker shows the selected Ollama model's details and runtime options
+func (m *Model) inspectFromPicker() tea.Cmd {
+	selected := m.selectedModel()
+	if AvailableModels[selected].Provider != "ollama" {
+		m.Settings.Status = "Only Ollama models have details and runtime options"
+		m.Settings.Failed = true
+		return nil
+	}
+	m.Settings.Inspect = selected
+	m.Settings.InspectInfo = nil
+	m.Settings.Cursor = 0
+	m.Settings.Status = ""
+	return showOllamaModel(selected)
+}
+
+// HandleSettingsClick switches to a clicked tab, returns true if a tab was clicked
+func (m *Model) HandleSettingsClick(msg tea.MouseMsg) bool {
+	for i := range settingsTabs {
+		if zone.Get(settingsTabZone(i)).InBounds(msg) {
+			m.closeInspect()
+			m.Settings.Editing = false
+			m.Settings.Tab = i
+			m.Settings.Cursor = 0
+			return true
+		}
+	}
+	return false
+}
+
+// renderSettingsTab renders the settings of the current tab, one per line with the selected one's help below it
+func (m *Model) renderSettingsTab(tab settingsTab) string {
+	var sb strings.Builder
+	for i, s := range tab.Settings {
+		value := s.Value(m)
+		switch {
+		case i == m.Settings.Cursor && m.Settings.Editing:
+			value = m.Settings.Input
+			if s.Kind == settingSecret {
+				value = strings.Repeat("•", len([]rune(value)))
+			}
+			value += CursorStyle.Render(" ")
+		case s.Kind == settingChoice:
+			value = "‹ " + value + " ›"
+		case value == "":
+			value = CommandPopupStyle.Render("default")
+		case s.Kind == settingSecret:
+			value = maskSecret(value)
+		}
+		line := "  " + runewidth.FillRight(s.Label, 20) + value
+		if i == m.Settings.Cursor {
+			line = MenuSelectedStyle.Render("> "+runewidth.FillRight(s.Label, 20)) + value
+			line += "\n    " + CommandPopupStyle.Render(s.Help)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// ConfigView renders the settings page: a tab bar, the current tab and where changes are saved
+func (m *Model) ConfigView(termHeight, termWidth int) string {
+	var content strings.Builder
+	content.WriteString(HeaderStyle.Render("Settings") + "\n")
+
+	tabs := make([]string, len(settingsTabs))
+	for i, tab := range settingsTabs {
+		if i == m.Settings.Tab {
+			tabs[i] = zone.Mark(settingsTabZone(i), MenuSelectedStyle.Render("["+tab.Title+"]"))
+		} else {
+			tabs[i] = zone.Mark(settingsTabZone(i), CommandPopupStyle.Render(" "+tab.Title+" "))
+		}
+	}
+	content.WriteString(strings.Join(tabs, " ") + "\n\n")
+
+	tab := m.currentSettingsTab()
+	switch {
+	case m.Settings.Inspect != "":
+		content.WriteString(m.ollamaDetails())
+		content.WriteString(m.renderSettingsTab(tab))
+	case len(tab.Settings) == 0:
+		// Everything but the model list takes about 20 lines
+		content.WriteString(m.modelList(termHeight - 20))
+	default:
+		content.WriteString(m.renderSettingsTab(tab))
+	}
+
+	target := "user config (" + config.UserFile() + ")"
+	if m.Settings.Project {
+		target = "project config (" + config.ProjectFile() + ")"
+	}
+	content.WriteString("\nSaving to the " + target + "\n")
+	if m.Settings.Status != "" {
+		style := SystemStyle
+		if m.Settings.Failed {
+			style = ErrorStyle
+		}
+		content.WriteString(style.Render(m.Settings.Status) + "\n")
+	}
+
+	k := m.keymap
+	content.WriteString("\n" + HeaderStyle.Render("Controls:"))
+	if m.Settings.Editing {
+		content.WriteString("\n" + k.ShortHelp(ActionMenuSelect) + ": Save\n" + k.ShortHelp(ActionMenuClose) + ": Cancel")
+	} else {
+		content.WriteString("\n" + k.ShortHelp(ActionMenuNextTab) + "/" + k.ShortHelp(ActionMenuPrevTab) + ": Switch tab")
+		if m.Settings.Tab == 0 && m.Settings.Inspect == "" {
+			content.WriteString(k.menuControls(ActionMenuSelect, ActionModelPull, ActionModelDelete, ActionModelInspect, ActionSettingsTarget, ActionMenuClose))
+		} else {
+			content.WriteString(k.menuControls(ActionMenuSelect, ActionSettingsTarget, ActionMenuClose))
+		}
+	}
+
+	configBox := PageStyle.
+		Width(termWidth - 24).
+		Height(termHeight - 5).
+		Render(content.String())
+
+	return zone.Scan(lipgloss.NewStyle().
+		Margin(0, 2).
+		Render(configBox))
+}
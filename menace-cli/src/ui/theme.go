@@ -0,0 +1,207 @@
+package ui
+
+import (
+	"fmt"
+	"menace-go/config"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// AutoTheme picks the dark or light theme from the terminal background
+const AutoTheme = "auto"
+
+// builtinThemes ship with Menace, config themes with the same name replace them
+var builtinThemes = map[string]config.Theme{
+	"dark": {
+		Text:            "15",
+		Heading:         "10",
+		Border:          "12",
+		Input:           "6",
+		User:            "2",
+		Agent:           "#8be9fd",
+		System:          "#bd93f9",
+		Error:           "#ff5555",
+		Muted:           "#6272a4",
+		Accent:          "#bd93f9",
+		AccentText:      "#282a36",
+		Selected:        "#8be9fd",
+		Highlight:       "#f1fa8c",
+		MatchBackground: "#44475a",
+		Markdown:        "dark",
+	},
+	"light": {
+		Text:            "#1f2328",
+		Heading:         "#116329",
+		Border:          "#0969da",
+		Input:           "#0550ae",
+		User:            "#1a7f37",
+		Agent:           "#0550ae",
+		System:          "#8250df",
+		Error:           "#cf222e",
+		Muted:           "#6e7781",
+		Accent:          "#8250df",
+		AccentText:      "#ffffff",
+		Selected:        "#0969da",
+		Highlight:       "#9a6700",
+		MatchBackground: "#fff8c5",
+		Markdown:        "light",
+	},
+	"high-contrast": {
+		Text:            "#ffffff",
+		Heading:         "#00ff00",
+		Border:          "#ffffff",
+		Input:           "#ffffff",
+		User:            "#00ff00",
+		Agent:           "#00ffff",
+		System:          "#ff00ff",
+		Error:           "#ff0000",
+		Muted:           "#c0c0c0",
+		Accent:          "#ffff00",
+		AccentText:      "#000000",
+		Selected:        "#ffff00",
+		Highlight:       "#ffff00",
+		MatchBackground: "#0000aa",
+		Markdown:        "dark",
+	},
+}
+
+// noColor is set by DisableColor, styles then only use bold, underline and reverse video
+var noColor bool
+
+// darkBackground is the terminal background the auto theme follows, see DetectBackground
+var darkBackground = true
+
+func init() {
+	ApplyTheme(builtinThemes["dark"])
+}
+
+// DisableColor turns off all colors, for NO_COLOR and --no-color.
+//
+// lipgloss would drop bold and reverse video along with the colors, but the cursor and
+// selections need them, so the ANSI profile is kept and the styles leave colors out instead.
+func DisableColor() {
+	noColor = true
+	lipgloss.SetColorProfile(termenv.ANSI)
+	ApplyTheme(config.Theme{})
+}
+
+// DetectBackground asks the terminal whether its background is dark, for the auto theme.
+//
+// The terminal answers on stdin, so this must run before the Bubble Tea program starts reading it.
+func DetectBackground() {
+	darkBackground = lipgloss.HasDarkBackground()
+}
+
+// ApplyTheme restyles the whole UI, already rendered markdown is thrown away
+func ApplyTheme(theme config.Theme) {
+	applyStyles(theme)
+	switch {
+	case noColor:
+		markdownBaseStyle = styles.ASCIIStyleConfig
+	case theme.Markdown == "light":
+		markdownBaseStyle = styles.LightStyleConfig
+	default:
+		markdownBaseStyle = styles.DarkStyleConfig
+	}
+	markdownRenderers = map[int]*glamour.TermRenderer{}
+	markdownCache = map[string][]string{}
+}
+
+// ResolveTheme looks up a config or built-in theme, filling colors it leaves empty from its base.
+//
+// "auto" and "" pick dark or light from the terminal background.
+func ResolveTheme(name string, themes map[string]config.Theme) (config.Theme, error) {
+	return resolveTheme(name, themes, map[string]bool{})
+}
+
+func resolveTheme(name string, themes map[string]config.Theme, seen map[string]bool) (config.Theme, error) {
+	if name == "" || name == AutoTheme {
+		name = "dark"
+		if !darkBackground {
+			name = "light"
+		}
+	}
+	// A config theme may extend the built-in theme it replaces
+	if theme, ok := themes[name]; ok && !seen[name] {
+		seen[name] = true
+		base := theme.Base
+		if base == "" {
+			if _, ok := builtinThemes[name]; ok {
+				base = name
+			}
+		}
+		baseTheme, err := resolveTheme(base, themes, seen)
+		if err != nil {
+			return config.Theme{}, fmt.Errorf("theme %s: %v", name, err)
+		}
+		return mergeTheme(baseTheme, theme), nil
+	}
+	if theme, ok := builtinThemes[name]; ok {
+		return theme, nil
+	}
+	if seen[name] {
+		return config.Theme{}, fmt.Errorf("theme %s extends itself", name)
+	}
+	return config.Theme{}, fmt.Errorf("unknown theme %s, available: %s", name, strings.Join(ThemeNames(themes), ", "))
+}
+
+// mergeTheme returns base with the colors set in theme
+func mergeTheme(base, theme config.Theme) config.Theme {
+	pick := func(base, override string) string {
+		if override != "" {
+			return override
+		}
+		return base
+	}
+	return config.Theme{
+		Text:            pick(base.Text, theme.Text),
+		Heading:         pick(base.Heading, theme.Heading),
+		Border:          pick(base.Border, theme.Border),
+		Input:           pick(base.Input, theme.Input),
+		User:            pick(base.User, theme.User),
+		Agent:           pick(base.Agent, theme.Agent),
+		System:          pick(base.System, theme.System),
+		Error:           pick(base.Error, theme.Error),
+		Muted:           pick(base.Muted, theme.Muted),
+		Accent:          pick(base.Accent, theme.Accent),
+		AccentText:      pick(base.AccentText, theme.AccentText),
+		Selected:        pick(base.Selected, theme.Selected),
+		Highlight:       pick(base.Highlight, theme.Highlight),
+		MatchBackground: pick(base.MatchBackground, theme.MatchBackground),
+		Markdown:        pick(base.Markdown, theme.Markdown),
+	}
+}
+
+// ThemeNames lists "auto", the built-in themes and the config themes, sorted
+func ThemeNames(themes map[string]config.Theme) []string {
+	names := []string{}
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	for name := range themes {
+		if _, ok := builtinThemes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{AutoTheme}, names...)
+}
+
+// SetTheme switches to the theme called name, keeping the old one on error
+func (m *Model) SetTheme(name string) error {
+	theme, err := ResolveTheme(name, m.themes)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = AutoTheme
+	}
+	m.theme = name
+	ApplyTheme(theme)
+	return nil
+}
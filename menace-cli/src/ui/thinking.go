@@ -17,20 +17,21 @@ func thinkingTick() tea.Cmd {
 }
 
 // StartThinking starts the thinking animation by setting the IsThinking flag to true,
-// resetting the ThinkingDots counter, and adding a "thinking" system message.
+// resetting the ThinkingDots counter, and adding a KindThinking placeholder message.
 // This function is typically used to indicate that the system is processing or waiting.
-// The "thinking" system message added by this function can be removed by calling StopThinking.
+// The placeholder added by this function can be removed by calling StopThinking.
 func (m *Model) StartThinking() {
 	m.IsThinking = true
 	m.ThinkingDots = 0
-	m.AddSystemMessage("thinking")
+	m.ThinkingStarted = time.Now()
+	m.AddMessage(Message{Kind: KindThinking, Content: ThinkingState})
 }
 
 // StopThinking stops the thinking animation and removes the thinking message
 func (m *Model) StopThinking() {
 	m.IsThinking = false
 	// Remove the thinking message if it exists
-	if len(m.Messages) > 0 && m.Messages[len(m.Messages)-1].Content == "thinking" {
+	if len(m.Messages) > 0 && m.Messages[len(m.Messages)-1].Kind == KindThinking {
 		m.Messages = m.Messages[:len(m.Messages)-1]
 	}
 }
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// TranscriptMarkdown renders the chat history as markdown
+func (m *Model) TranscriptMarkdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Menace transcript\n\nSaved %s, model %s\n", time.Now().Format("2006-01-02 15:04"), m.agent.Model))
+	for _, msg := range m.Messages {
+		switch msg.Kind {
+		case KindThinking:
+			continue
+		case KindUser:
+			sb.WriteString("\n## You\n\n" + msg.Content + "\n")
+		case KindAgent:
+			sb.WriteString("\n## Menace\n\n" + msg.Content + "\n")
+		case KindExplanation:
+			sb.WriteString("\n_" + msg.Content + "_\n")
+		case KindCommand:
+			if payload, ok := msg.Payload.(*CommandPayload); ok {
+				sb.WriteString("\n```sh\n$ " + payload.Command + "\n```\n")
+				continue
+			}
+			sb.WriteString("\n```\n" + strings.TrimRight(msg.Content, "\n") + "\n```\n")
+		case KindDiff:
+			if payload, ok := msg.Payload.(*DiffPayload); ok {
+				sb.WriteString("\nChanged `" + payload.Path + "`:\n\n```diff\n" + diffMarkdown(payload.Diffs) + "```\n")
+				continue
+			}
+			sb.WriteString("\n```\n" + strings.TrimRight(msg.Content, "\n") + "\n```\n")
+		default:
+			sb.WriteString("\n```\n" + strings.TrimRight(msg.Content, "\n") + "\n```\n")
+		}
+		if msg.Duration > 0 && msg.Kind != KindAgent {
+			sb.WriteString(fmt.Sprintf("_(%s)_\n", msg.Duration.Round(time.Millisecond)))
+		}
+	}
+	return sb.String()
+}
+
+// diffMarkdown renders line diffs as unified-diff style lines
+func diffMarkdown(diffs []LineDiff) string {
+	var sb strings.Builder
+	for _, diff := range diffs {
+		switch diff.Type {
+		case Add:
+			sb.WriteString(fmt.Sprintf("+%d: %s\n", diff.LineIndex, diff.NewContent))
+		case Delete:
+			sb.WriteString(fmt.Sprintf("-%d: %s\n", diff.LineIndex, diff.OldContent))
+		default:
+			sb.WriteString(fmt.Sprintf("-%d: %s\n+%d: %s\n", diff.LineIndex, diff.OldContent, diff.LineIndex, diff.NewContent))
+		}
+	}
+	return sb.String()
+}
+
+// SaveTranscript writes the chat history as markdown to path
+func (m *Model) SaveTranscript(path string) error {
+	return os.WriteFile(path, []byte(m.TranscriptMarkdown()), 0644)
+}
@@ -1,9 +1,10 @@
 package ui
 
 import (
-	"encoding/json"
-	"strings"
+	"menace-go/config"
+	"menace-go/llmServer"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -27,6 +28,7 @@ type CommandSuggestionMsg struct {
 	Command string
 	Reason  string
 	AwaitingCommandApproval bool
+	Narrative string // prose the model wrote around the block
 }
 
 // Represents a function call suggestion if the LLM returns one.
@@ -35,6 +37,21 @@ type FunctionCallMsg struct {
 	AwaitingCommandApproval bool
 	Reason string
 	Args   map[string]interface{}
+	Narrative string // prose the model wrote around the block
+}
+
+// RetriedResponseMsg wraps a response that only came through after the agent
+// fed malformed blocks back to the model. Result is the final response.
+type RetriedResponseMsg struct {
+	Attempts []llmServer.FailedAttempt
+	Result   tea.Msg
+}
+
+// MalformedResponseMsg is returned when the LLM response contains a
+// [COMMAND_SUGGESTION] or [FUNCTION_CALL] block that could not be parsed.
+type MalformedResponseMsg struct {
+	Content string
+	Err     *llmServer.ParseError
 }
 
 // SystemMessage represents a system-level message, typically used for conveying
@@ -46,97 +63,183 @@ type SystemMessage struct {
 }
 
 // Styles for Menace CLI UI
-// Includes "boxes" for chat and input area
+// Includes "boxes" for chat and input area, set from the theme by applyStyles
 var (
+	SidebarStyle lipgloss.Style
+	HeaderStyle  lipgloss.Style
+	ChatStyle    lipgloss.Style
+	InputStyle   lipgloss.Style
+	UserStyle    lipgloss.Style
+	SystemStyle  lipgloss.Style
+	ErrorStyle   lipgloss.Style
+	LLMStyle     lipgloss.Style
+	// Styles for the header and copy button above code blocks in assistant messages
+	CodeHeaderStyle lipgloss.Style
+	CodeCopyStyle   lipgloss.Style
+	// Style for text selected in the chat pane
+	SelectionStyle lipgloss.Style
+	// Style for text selected in the input
+	InputSelectionStyle lipgloss.Style
+	// Styles for transcript search matches, the current one stands out
+	SearchMatchStyle   lipgloss.Style
+	SearchCurrentStyle lipgloss.Style
+	// Style for the expand/collapse line of long outputs
+	CollapseToggleStyle lipgloss.Style
+	// Vim mode indicator in the input border
+	VimModeStyle lipgloss.Style
+	// Style for the block cursor in the input
+	CursorStyle lipgloss.Style
+	ButtonStyle lipgloss.Style
+	// Styles for the slash command popup above the input
+	CommandPopupStyle         lipgloss.Style
+	CommandPopupSelectedStyle lipgloss.Style
+	// Style for the question above the askUser option menu
+	QuestionStyle lipgloss.Style
+	// Styles for the sidebar info and section titles
+	InfoStyle          lipgloss.Style
+	SectionHeaderStyle lipgloss.Style
+	// Style for the border of full-page views like /memory and the model picker
+	PageStyle lipgloss.Style
+	// Style for the selected entry of those pages
+	MenuSelectedStyle lipgloss.Style
+	// Style for attachment chips shown in the input box
+	AttachmentChipStyle lipgloss.Style
+	// Style for the completion list shown above the input
+	MentionSuggestionStyle lipgloss.Style
+)
+
+var ThinkingState = "thinking"
+
+// applyStyles rebuilds the styles above from theme.
+//
+// Without color, highlights fall back to reverse video and underlines.
+func applyStyles(theme config.Theme) {
+	color := func(c string) lipgloss.TerminalColor {
+		if c == "" || noColor {
+			return lipgloss.NoColor{}
+		}
+		return lipgloss.Color(c)
+	}
+
 	SidebarStyle = lipgloss.NewStyle().
-			Width(20).
-			PaddingRight(1).
-			Foreground(lipgloss.Color("15"))
+		Width(20).
+		PaddingRight(1).
+		Foreground(color(theme.Text))
 
 	HeaderStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("10")).
-			MarginBottom(1)
+		Bold(true).
+		Foreground(color(theme.Heading)).
+		MarginBottom(1)
 
 	ChatStyle = lipgloss.NewStyle().
-			Padding(1).
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("12"))
+		Padding(1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color(theme.Border))
 
 	InputStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("6")).
-			Bold(true)
+		Foreground(color(theme.Input)).
+		Bold(true)
 
 	UserStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("2")).
-			Bold(true)
+		Foreground(color(theme.User)).
+		Bold(true)
 
 	SystemStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#bd93f9")).
-			Bold(true)
+		Foreground(color(theme.System)).
+		Bold(true)
+
+	ErrorStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Error)).
+		Bold(true)
 
 	LLMStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("#8be9fd")).
-			Italic(true).
-			Bold(true)
-	// Style for the block cursor in the input
-	CursorStyle = lipgloss.NewStyle().Reverse(true)
+		Foreground(color(theme.Agent)).
+		Italic(true).
+		Bold(true)
 
-	ButtonStyle = lipgloss.NewStyle().
-			Width(12). // fixed width for both buttons
-			Align(lipgloss.Center).
-			Padding(0, 0).
-			Margin(0, 0).
-			Foreground(lipgloss.Color("#f8f8f2")).
-			Bold(true).
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("#bd93f9"))
-
-	ThinkingState = "thinking"
-)
+	CodeHeaderStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Muted))
 
-// parseFunctionCall parses a [FUNCTION_CALL] block from the LLM response and returns a FunctionCallMsg.
-// Returns nil if no function call is found or parsing fails.
-func parseFunctionCall(response string) *FunctionCallMsg {
-	start := strings.Index(response, "[FUNCTION_CALL]")
-	end := strings.Index(response, "[/FUNCTION_CALL]")
-	if start == -1 || end == -1 {
-		return nil
-	}
-	content := response[start:end]
+	CodeCopyStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Accent)).
+		Bold(true)
 
-	reasonStart := strings.Index(content, "Reason:")
-	payloadStart := strings.Index(content, "Payload:")
-	approvalStart := strings.Index(content, "AwaitingCommandApproval:")
-	if reasonStart == -1 || payloadStart == -1 || approvalStart == -1 {
-		return nil
-	}
+	SelectionStyle = lipgloss.NewStyle().Reverse(true)
 
-	reason := strings.TrimSpace(content[reasonStart+len("Reason:") : approvalStart])
-	cmdApproval := strings.TrimSpace(content[approvalStart+len("AwaitingCommandApproval:") : payloadStart]) == "true"
-	payload := strings.TrimSpace(content[payloadStart+len("Payload:"):])
-	
-	// Find the JSON object in the payload
-	jsonStart := strings.Index(payload, "{")
-	jsonEnd := strings.LastIndex(payload, "}")
-	if jsonStart == -1 || jsonEnd == -1 || jsonEnd <= jsonStart {
-		return nil
-	}
-	jsonStr := payload[jsonStart : jsonEnd+1]
+	InputSelectionStyle = lipgloss.NewStyle().
+		Background(color(theme.Selected)).
+		Foreground(color(theme.AccentText))
 
-	var parsed struct {
-		Name string                 `json:"name"`
-		Args map[string]interface{} `json:"args"`
-		AwaitingCommandApproval bool `json:"AwaitingCommandApproval"`
-	}
-	if err := json.Unmarshal([]byte(jsonStr), &parsed); err != nil {
-		return nil
-	}
+	SearchMatchStyle = lipgloss.NewStyle().
+		Background(color(theme.MatchBackground)).
+		Foreground(color(theme.Highlight))
 
-	return &FunctionCallMsg{
-		Name:   parsed.Name,
-		Reason: reason,
-		AwaitingCommandApproval: cmdApproval,
-		Args:   parsed.Args,
+	SearchCurrentStyle = lipgloss.NewStyle().
+		Background(color(theme.Highlight)).
+		Foreground(color(theme.AccentText)).
+		Bold(true)
+
+	CollapseToggleStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Muted)).
+		Italic(true)
+
+	VimModeStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Highlight)).
+		Bold(true)
+
+	CursorStyle = lipgloss.NewStyle().Reverse(true)
+
+	ButtonStyle = lipgloss.NewStyle().
+		Width(12). // fixed width for both buttons
+		Align(lipgloss.Center).
+		Padding(0, 0).
+		Margin(0, 0).
+		Foreground(color(theme.Text)).
+		Bold(true).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color(theme.Accent))
+
+	CommandPopupStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Muted))
+
+	CommandPopupSelectedStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Selected)).
+		Bold(true)
+
+	QuestionStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Heading)).
+		Bold(true)
+
+	InfoStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Agent)).
+		Bold(true).MarginBottom(1)
+
+	SectionHeaderStyle = lipgloss.NewStyle().
+		Bold(true).
+		Foreground(color(theme.Accent))
+
+	PageStyle = lipgloss.NewStyle().
+		Padding(1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(color(theme.Border))
+
+	MenuSelectedStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Selected)).
+		Bold(true)
+
+	AttachmentChipStyle = lipgloss.NewStyle().
+		Foreground(color(theme.AccentText)).
+		Background(color(theme.Accent)).
+		Padding(0, 1)
+
+	MentionSuggestionStyle = lipgloss.NewStyle().
+		Foreground(color(theme.Muted)).
+		Italic(true)
+
+	if noColor {
+		InputSelectionStyle = lipgloss.NewStyle().Reverse(true)
+		SearchMatchStyle = lipgloss.NewStyle().Underline(true)
+		SearchCurrentStyle = lipgloss.NewStyle().Reverse(true).Bold(true)
+		AttachmentChipStyle = AttachmentChipStyle.Reverse(true)
 	}
 }
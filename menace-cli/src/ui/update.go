@@ -1,9 +1,9 @@
 package ui
 
 import (
-	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	zone "github.com/lrstanley/bubblezone"
@@ -26,6 +26,17 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case ThinkingMsg:
 		return m.UpdateThinking()
 
+	case OllamaModelsMsg:
+		m.HandleOllamaModels(msg)
+		return m, nil
+	case OllamaPullMsg:
+		return m, m.HandleOllamaPull(msg)
+	case OllamaDeleteMsg:
+		return m, m.HandleOllamaDelete(msg)
+	case OllamaShowMsg:
+		m.HandleOllamaShow(msg)
+		return m, nil
+
 	// Styles to fit terminal size
 	case tea.WindowSizeMsg:
 		m.ResizeWindow(msg)
@@ -34,11 +45,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		switch msg.Button {
 		case tea.MouseButtonWheelUp:
 			// fmt.Println("Mouse wheel up detected")
-			m.HandleScroll(1)
+			if m.Help.Open {
+				m.ScrollHelp(-1)
+			} else {
+				m.HandleScroll(1)
+			}
 		case tea.MouseButtonWheelDown:
 			// fmt.Println("Mouse wheel down detected")
-			m.HandleScroll(-1)
+			if m.Help.Open {
+				m.ScrollHelp(1)
+			} else {
+				m.HandleScroll(-1)
+			}
 		case tea.MouseButtonLeft:
+			// Presses and drags select text in the chat pane, a release that ends a selection isn't a click
+			if m.HandleChatMouse(msg) {
+				return m, nil
+			}
 			if msg.Action == tea.MouseActionRelease {
 				// Clear any existing selection
 				m.IsHighlighting = false
@@ -47,13 +70,23 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.SelectionEndX = 0
 				m.SelectionEndY = 0
 
+				if m.IsConfigOpen && m.HandleSettingsClick(msg) {
+					return m, nil
+				}
+				if m.QuestionOpen() {
+					if cmd, handled := m.HandleQuestionClick(msg); handled {
+						return m, cmd
+					}
+				}
+				if m.HandleMessageClick(msg) || m.HandleCodeCopyClick(msg) || m.HandleCollapseClick(msg) {
+					return m, nil
+				}
 				if zone.Get("help").InBounds(msg) {
-					m.AddSystemMessage("testing system message")
+					m.OpenHelp()
 					return m, nil
 				}
 				if zone.Get("config").InBounds(msg) {
-					m.OpenConfig()
-					return m, nil
+					return m, m.OpenConfig()
 				}
 			}
 		}
@@ -61,61 +94,61 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Handle key presses
 	case tea.KeyMsg:
 
+		if m.Help.Open {
+			m.HandleHelpKey(msg)
+			return m, nil
+		}
 		if m.IsConfigOpen {
-			switch msg.String() {
-			case tea.KeyEnter.String():
-				m.SelectModel()
-				changed = true
-			case tea.KeyEsc.String():
-				m.CloseConfig()
-				changed = true
-			case tea.KeyUp.String(), tea.KeyDown.String():
-				m.HandleConfigNavigation(msg.String())
-				changed = true
-			}
+			return m, m.HandleSettingsKey(msg)
+		}
+		if m.IsMemoryOpen {
+			m.HandleMemoryKey(msg.String())
+			return m, nil
+		}
+		// Scrollback and transcript search work in every state, even while a command awaits approval
+		if m.Search.Open && m.HandleSearchKey(msg) {
+			return m, nil
+		}
+		if m.HandleScrollKey(msg.String()) {
 			return m, nil
 		}
 		// handle execution of command when awaiting command approval
 		if m.AwaitingCommandApproval {
-			switch msg.String() {
-			case "y":
+			switch m.keymap.Action(ScopeApproval, msg.String()) {
+			case ActionApprove:
 				m.AwaitingCommandApproval = false
 				var output string
 				var err error
+				var result Message
+				start := time.Now()
 				if m.PendingFunctionCall != nil {
 					output, err = m.ExecuteFunctionCall(m.PendingFunctionCall)
+					result = functionResultMessage(m.PendingFunctionCall, output, err, time.Since(start))
 					m.PendingFunctionCall = nil
 				} else if m.PendingCommand != nil {
 					output, err = runShellCommand(m.PendingCommand.Command)
+					result = commandResultMessage(m.PendingCommand.Command, output, err, time.Since(start))
 					m.PendingCommand = nil
 				}
-				if err != nil {
-					m.AddSystemMessage(fmt.Sprintf("Error: %s", err))
-				} else {
+				if err == nil {
 					cleanOutput := strings.ReplaceAll(output, "\r\n", "\n")
 					cleanOutput = strings.ReplaceAll(cleanOutput, "\r", "\n")
 					cleanOutput = strings.ReplaceAll(cleanOutput, "\t", "    ")
 					if cleanOutput != "" {
 						cleanOutput = "The above task was done successfully"
 					}
-					m.AddSystemMessage(fmt.Sprintf("Output:\n%s", cleanOutput))
+					result.Content = fmt.Sprintf("Output:\n%s", cleanOutput)
 				}
+				m.AddMessage(result)
 				m.StartThinking()
 				return m, tea.Batch(
 					func() tea.Msg {
-						response, cmdSuggestion, err := m.agent.SendMessage(context.Background(), output)
-						if err != nil {
-							return SystemMessage{Content: "Error: " + err.Error()}
-						}
-						if cmdSuggestion != nil {
-							return CommandSuggestionMsg{Command: cmdSuggestion.Command, Reason: cmdSuggestion.Reason}
-						}
-						return LLMResponseMsg{Content: response}
+						return m.AIChat(output)
 					},
 					thinkingTick(),
 				)
 
-			case "n":
+			case ActionReject:
 				// Cancel
 				m.AwaitingCommandApproval = false
 				m.PendingCommand = nil
@@ -123,20 +156,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.StartThinking()
 				return m, tea.Batch(
 					func() tea.Msg {
-
-						response, cmdSuggestion, err := m.agent.SendMessage(context.Background(), "No, stop for now.")
-						if err != nil {
-							return SystemMessage{Content: "Error: " + err.Error()}
-						}
-						if cmdSuggestion != nil {
-							// Try not to get to this case...
-							return CommandSuggestionMsg{Command: cmdSuggestion.Command, Reason: cmdSuggestion.Reason}
-						}
-						return LLMResponseMsg{Content: response}
+						return m.AIChat("No, stop for now.")
 					},
 					thinkingTick(),
 				)
-			case "e":
+			case ActionEditCommand:
+				// Only shell commands can be edited
+				if m.PendingCommand == nil {
+					return m, nil
+				}
 				// Switch to edit mode (maybe put command in input box)
 				m.Input = m.PendingCommand.Command
 				m.AwaitingCommandApproval = false
@@ -147,46 +175,96 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		switch msg.String() {
-		//if ctrl+c is pressed, quit the program
-		case tea.KeyCtrlC.String():
+		// The askUser menu takes navigation, option numbers and Enter, everything else types an "Other" answer
+		if m.QuestionOpen() {
+			if cmd, handled := m.HandleQuestionKey(msg.String()); handled {
+				return m, cmd
+			}
+		}
+
+		// Completions are only valid for the keystroke right after Tab
+		if !m.keymap.Matches(msg.String(), ActionComplete) {
+			m.MentionSuggestions = nil
+		}
+
+		// Keys that drive the slash command popup while it is open
+		if m.CommandPopupOpen() {
+			switch m.keymap.Action(ScopeMenu, msg.String()) {
+			case ActionMenuUp:
+				m.HandleCommandPopupNavigation(tea.KeyUp.String())
+				return m, nil
+			case ActionMenuDown:
+				m.HandleCommandPopupNavigation(tea.KeyDown.String())
+				return m, nil
+			case ActionMenuSelect:
+				// Falls through to sending if the key also sends
+				m.CompleteSlashCommand()
+			}
+			if m.keymap.Matches(msg.String(), ActionComplete) {
+				m.CompleteSlashCommand()
+				m.UpdateWindowStart(m.GetMaxInputWidth())
+				return m, nil
+			}
+		}
+		// Any other key changes what the popup matches, start again from the top
+		m.CommandPopupCursor = 0
+
+		// Vim normal and visual mode take the keys they use, the rest work as usual
+		if m.Vim.Enabled && m.HandleVimKey(msg) {
+			m.UpdateWindowStart(m.GetMaxInputWidth())
+			return m, nil
+		}
+
+		// Edits below are recorded for undo once the key is handled
+		before := m.snapshot()
+
+		switch m.keymap.Action(ScopeInput, msg.String()) {
+		//copies the selection, or quits the program if the key is also bound to quit
+		case ActionCopy:
+			if m.ChatSelection.Active {
+				m.CopyToClipboard(m.SelectedChatText())
+				m.ClearChatSelection()
+				return m, nil
+			}
 			if m.IsHighlighting {
 				selectedText := m.GetSelectedText()
 				m.CopyToClipboard(selectedText)
 				// Clear selection after copying
-				m.IsHighlighting = false
-				m.SelectionStartX = 0
-				m.SelectionStartY = 0
-				m.SelectionEndX = 0
-				m.SelectionEndY = 0
+				m.ClearInputSelection()
 				return m, nil
 			}
+			if m.keymap.Matches(msg.String(), ActionQuit) {
+				return m, tea.Quit
+			}
+
+		case ActionQuit:
 			return m, tea.Quit
 
-		case tea.KeyCtrlX.String():
+		case ActionCut:
 			if m.IsHighlighting {
 				m.CutSelectedText()
 				changed = true
 			}
 
-		case tea.KeyCtrlV.String():
+		case ActionPaste:
 			clipboardContent := m.GetClipboardContent()
+			// A copied image file path or image data becomes an attachment instead of text
+			if path := imagePathFromPaste(clipboardContent); path != "" {
+				m.AttachImage(path)
+				changed = true
+				break
+			}
+			if clipboardContent == "" && m.AttachClipboardImage() {
+				changed = true
+				break
+			}
 			if clipboardContent != "" {
 				// Normalize clipboard content
 				clipboardContent = strings.ReplaceAll(clipboardContent, "\r\n", "\n")
 				clipboardContent = strings.ReplaceAll(clipboardContent, "\r", "\n")
 
 				// If text is selected, replace it
-				if m.IsHighlighting {
-					m.Input = ""
-					m.CursorX = 0
-					m.CursorY = 0
-					m.IsHighlighting = false
-					m.SelectionStartX = 0
-					m.SelectionStartY = 0
-					m.SelectionEndX = 0
-					m.SelectionEndY = 0
-				}
+				m.DeleteSelection()
 				// Insert clipboard content
 				lines := strings.Split(clipboardContent, "\n")
 				for i, line := range lines {
@@ -203,77 +281,148 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Case for Enter key press -- START OF DEBUGGING
 		// Should send message to LLM
-		case tea.KeyEnter.String():
-			
-			if m.Input == "" {
+		case ActionSend:
+
+			if m.Input == "" && len(m.Attachments) == 0 {
+				return m, nil
+			}
+
+			// An edited message is resent from where it was, a command would run on the current conversation
+			if _, _, ok := parseSlashCommand(m.Input); ok && m.IsEditingMessage {
+				m.AddSystemMessage("A slash command can't replace an earlier message, " + m.keymap.ShortHelp(ActionCancel) + " stops editing")
 				return m, nil
 			}
 
+			// Slash commands are handled locally, never sent to the model
+			if cmd, handled := m.HandleSlashCommand(m.Input); handled {
+				return m, cmd
+			}
+			// One turn at a time, the reply would land in the middle of the next one
+			if m.IsThinking {
+				m.AddSystemMessage("Wait for the agent to finish before sending another message")
+				return m, nil
+			}
+			// A new message from the user ends any custom command's model/tool override,
+			// local commands like /cost don't
+			m.agent.ClearOverride()
+
+			if len(m.Attachments) > 0 && !m.agent.SupportsVision() {
+				m.AddSystemMessage("Model " + m.agent.Model + " does not support images, switch to a vision model or remove the attachments with backspace")
+				return m, nil
+			}
+
+			// Sending an edited message forks the conversation at that message
+			if m.IsEditingMessage {
+				if err := m.rewindToEditedMessage(); err != nil {
+					m.AddErrorMessage(err)
+					return m, nil
+				}
+			}
+
+			// Inline @file mentions for the agent, the transcript only shows a compact reference
+			userInput, mentions, mentionErrs := ExpandMentions(m.Input)
+			for _, err := range mentionErrs {
+				m.AddSystemMessage("Could not include file: " + err.Error())
+			}
+
 			// Add user message to UI
-			m.AddUserMessage(m.Input)
+			shown := m.Input
+			if len(mentions) > 0 {
+				shown += "\n" + mentionLabel(mentions)
+			}
+			if len(m.Attachments) > 0 {
+				shown += "\n" + attachmentLabel(m.Attachments)
+			}
+			m.AddUserMessage(strings.TrimSpace(shown))
+			m.Messages[len(m.Messages)-1].Input = m.Input
 
 			// Start thinking animation
 			m.StartThinking()
 
-			// Capture input before clearing
-			userInput := m.Input
+			// Capture attachments before clearing
+			images := m.Attachments
 
 			// Clear input
 			m.ClearState()
+			m.Attachments = nil
+			m.MentionSuggestions = nil
 
 			// Send to agent and get response asynchronously via Bubble Tea command
 			// All the return types are re-entered into this large switch statement
 			// Check case CommandSuggestionMsg, LLMResponseMsg, and SystemMessage for more details
 			return m, tea.Batch(
 				func() tea.Msg {
-					response, cmdSuggestion, err := m.agent.SendMessage(
-						context.Background(), 
-						userInput,
-					)
-					// fmt.Println("userInput: ", userInput)
-					// fmt.Println("response: ", response)
-					if err != nil {
-						return SystemMessage{Content: "Error: " + err.Error()}
-					}
-					if cmdSuggestion != nil {
-						return CommandSuggestionMsg{
-							Command: cmdSuggestion.Command, 
-							Reason: cmdSuggestion.Reason, 
-							AwaitingCommandApproval: cmdSuggestion.AwaitingCommandApproval,
-						}
-					}
-					return LLMResponseMsg{Content: response}
+					return m.AIChat(userInput, images...)
 				},
 				thinkingTick(),
 			)
 
-		//Case for horizontal cursor movement
-		case tea.KeyLeft.String(), tea.KeyRight.String():
-			m.HandleHorizontalCursorMovement(msg.String())
+		case ActionCancel:
+			m.ClearChatSelection()
+			if m.IsEditingMessage {
+				m.CancelEdit()
+				changed = true
+			}
+
+		//Case for undo and redo of input edits
+		case ActionUndo:
+			m.Undo()
+			m.UpdateWindowStart(m.GetMaxInputWidth())
+			return m, nil
+
+		case ActionRedo:
+			m.Redo()
+			m.UpdateWindowStart(m.GetMaxInputWidth())
+			return m, nil
+
+		//Case for word-wise deletion, Ctrl+Backspace arrives as ctrl+h in most terminals
+		case ActionDeleteWordBack:
+			m.DeleteWordBackward()
+			changed = true
+
+		case ActionDeleteWordForward:
+			m.DeleteWordForward()
+			changed = true
+
+		//Case for deleting to the start or end of the line
+		case ActionDeleteToLineStart:
+			m.DeleteToLineStart()
 			changed = true
 
-		//Case for vertical cursor movement
-		case tea.KeyUp.String(), tea.KeyDown.String():
-			m.HandleVerticalCursorMovement(msg.String())
+		case ActionDeleteToLineEnd:
+			m.DeleteToLineEnd()
 			changed = true
 
 		//Case for backspace key press
-		case tea.KeyBackspace.String():
+		case ActionDeleteBack:
+			// Backspace on an empty input removes the last attachment chip
+			if m.Input == "" && len(m.Attachments) > 0 {
+				m.RemoveLastAttachment()
+				return m, nil
+			}
 			m.HandleBackSpace()
 			changed = true
 
 		//Case for delete key press
-		case tea.KeyDelete.String(), tea.KeyCtrlD.String():
+		case ActionDeleteForward:
 			m.HandleDelete()
 			changed = true
 
 		//Case for newline key press
-		case tea.KeyShiftDown.String():
+		//Shift+Enter is indistinguishable from Enter in most terminals, Alt+Enter and Ctrl+J work everywhere
+		case ActionNewline:
+			m.DeleteSelection()
 			m.InsertNewLine()
 			changed = true
 
+		//Case for tab key press, completes @file mentions
+		case ActionComplete:
+			if m.CompleteMention() {
+				changed = true
+			}
+
 		//Case for ctrl A key press
-		case tea.KeyCtrlA.String():
+		case ActionSelectAll:
 			m.IsHighlighting = true
 			m.SelectAll()
 			changed = true
@@ -281,29 +430,47 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		//general key press
 		//Inserts single character input into the cursor position
 		default:
-			if len(msg.String()) == 1 {
-				if m.IsHighlighting {
-					m.Input = ""
-					m.CursorX = 0
-					m.CursorY = 0
-					m.IsHighlighting = false
-					m.SelectionStartX = 0
-					m.SelectionStartY = 0
-					m.SelectionEndX = 0
-					m.SelectionEndY = 0
+			//Cursor movement: arrows, Home/End, Ctrl+E and word motions, with Shift to select
+			if m.HandleCursorKey(m.keymap.Action(ScopeInput, msg.String())) {
+				changed = true
+				break
+			}
+			// Bracketed paste, e.g. a file dragged onto the terminal
+			if msg.Paste {
+				pasted := string(msg.Runes)
+				if path := imagePathFromPaste(pasted); path != "" {
+					m.AttachImage(path)
+				} else {
+					for _, char := range strings.ReplaceAll(pasted, "\r\n", "\n") {
+						if char == '\n' {
+							m.InsertNewLine()
+						} else {
+							m.InsertCharacter(string(char))
+						}
+					}
 				}
+				changed = true
+				break
+			}
+			if len(msg.String()) == 1 {
+				m.DeleteSelection()
 				m.InsertCharacter(msg.String())
 				changed = true
 			}
 		}
+		typing := (msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace) && !msg.Paste && len(msg.Runes) == 1
+		m.RecordEdit(before, typing)
 
 	// Adding extra context prior to actually executing the commands, think of this as pre-run add-ons
 	case CommandSuggestionMsg:
 		m.PendingCommand = &msg
 		m.PendingFunctionCall = nil
-		m.AwaitingCommandApproval = msg.AwaitingCommandApproval
+		m.AwaitingCommandApproval = m.needsApproval(msg.AwaitingCommandApproval)
 		m.StopThinking()
-		m.AddAgentMessage(fmt.Sprintf("Explanation: %s", msg.Reason))
+		if msg.Narrative != "" {
+			m.AddResponse(KindAgent, msg.Narrative)
+		}
+		m.AddResponse(KindExplanation, fmt.Sprintf("Explanation: %s", msg.Reason))
 
 		// For git commands, the LLM gets extra context to guide it to its next step
 		if strings.HasPrefix(msg.Command, "git add") {
@@ -317,7 +484,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Not all commands needs human intervention, so we can skip the command execution handled in case SkipStepMsg
 		if m.AwaitingCommandApproval {
-			m.AddSystemMessage(fmt.Sprintf("Command suggestion: %s\nExecute command? (y/n/e)", msg.Command))
+			m.AddMessage(Message{
+				Kind:    KindCommand,
+				Content: fmt.Sprintf("Command suggestion: %s\nExecute command? %s", msg.Command, m.keymap.approvalHint()),
+				Payload: &CommandPayload{Command: msg.Command, ExitCode: -1},
+			})
 			return m, nil
 		} else {
 			return m, tea.Batch(
@@ -329,31 +500,68 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			)
 		}
 
-	case LLMResponseMsg:
-		// Try to parse for a function call
-		if fnCall := parseFunctionCall(msg.Content); fnCall != nil {
-			m.PendingFunctionCall = fnCall
-			m.PendingCommand = nil
-			m.AwaitingCommandApproval = fnCall.AwaitingCommandApproval
-			m.StopThinking()
-			m.AddAgentMessage(fmt.Sprintf("Explanation: %s", fnCall.Reason))
+	case FunctionCallMsg:
+		fnCall := &msg
+		m.PendingFunctionCall = fnCall
+		m.PendingCommand = nil
+		m.AwaitingCommandApproval = m.needsApproval(fnCall.AwaitingCommandApproval)
+		m.StopThinking()
+		if fnCall.Narrative != "" {
+			m.AddResponse(KindAgent, fnCall.Narrative)
+		}
 
-			if fnCall.AwaitingCommandApproval {
-				m.AddSystemMessage(fmt.Sprintf("Function call suggestion: %s\nExecute function? (y/n/e)", fnCall.Name))
+		// Questions never need approval, the answer is the function output
+		if fnCall.Name == llmServer.AskUserFunction {
+			m.PendingFunctionCall = nil
+			m.AwaitingCommandApproval = false
+			question, err := llmServer.ParseQuestion(&llmServer.FunctionCall{Name: fnCall.Name, Args: fnCall.Args})
+			if err != nil {
+				m.AddErrorMessage(err)
 				return m, nil
-			} else {
-				m.StartThinking()
-				return m, tea.Batch(
-					func() tea.Msg {
-						return SkipStepMsg{Command_to_execute: nil, Function_to_execute: fnCall}
-					},
-					thinkingTick(),
-				)
 			}
+			m.AskQuestion(question)
+			return m, nil
 		}
+		m.AddResponse(KindExplanation, fmt.Sprintf("Explanation: %s", fnCall.Reason))
+
+		if m.AwaitingCommandApproval {
+			m.AddMessage(Message{
+				Kind:    KindCommand,
+				Content: fmt.Sprintf("Function call suggestion: %s\nExecute function? %s", fnCall.Name, m.keymap.approvalHint()),
+				Payload: &FunctionPayload{Name: fnCall.Name, Args: fnCall.Args},
+			})
+			return m, nil
+		} else {
+			m.StartThinking()
+			return m, tea.Batch(
+				func() tea.Msg {
+					return SkipStepMsg{Command_to_execute: nil, Function_to_execute: fnCall}
+				},
+				thinkingTick(),
+			)
+		}
+
+	case LLMResponseMsg:
 		// Handle the case where no funciton or command is needed, just textual response
 		m.StopThinking()
-		m.AddAgentMessage(msg.Content)
+		m.AddResponse(KindAgent, msg.Content)
+		return m, nil
+
+	// The agent already bounced malformed blocks back to the model.
+	// Only show a one-line summary per failed attempt, then handle the final response.
+	case RetriedResponseMsg:
+		m.StopThinking()
+		for i, attempt := range msg.Attempts {
+			m.AddSystemMessage(fmt.Sprintf("↻ Retry %d/%d: %s", i+1, llmServer.MaxToolCallRetries, attempt.Err))
+		}
+		return m.Update(msg.Result)
+
+	// The model tried to suggest a command or function but the block didn't parse.
+	// Show everything it wrote so nothing is lost, plus what went wrong.
+	case MalformedResponseMsg:
+		m.StopThinking()
+		m.AddResponse(KindAgent, msg.Content)
+		m.AddMessage(Message{Kind: KindError, Content: fmt.Sprintf("Could not run the model's suggestion: %s", msg.Err)})
 		return m, nil
 
 	case SystemMessage:
@@ -365,55 +573,40 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.StopThinking()
 		if msg.Command_to_execute != nil {
 			m.PendingCommand = msg.Command_to_execute
-			m.AddSystemMessage(fmt.Sprintf("Executing command: %s ...\n", m.PendingCommand.Command))
+			m.AddMessage(Message{
+				Kind:    KindCommand,
+				Content: fmt.Sprintf("Executing command: %s ...\n", m.PendingCommand.Command),
+				Payload: &CommandPayload{Command: m.PendingCommand.Command, ExitCode: -1},
+			})
+			start := time.Now()
 			output, err := runShellCommand(m.PendingCommand.Command)
 			cleanOutput := strings.ReplaceAll(output, "\r\n", "\n")
 			cleanOutput = strings.ReplaceAll(cleanOutput, "\r", "\n")
 			cleanOutput = strings.ReplaceAll(cleanOutput, "\t", "    ")
-			if err != nil {
-				m.AddSystemMessage(fmt.Sprintf("Error: %s", err))
-			} else {
-				m.AddSystemMessage(fmt.Sprintf("Output:\n%s", cleanOutput))
-			}
+			m.AddMessage(commandResultMessage(m.PendingCommand.Command, cleanOutput, err, time.Since(start)))
 			m.StartThinking()
 			m.PendingCommand = nil
 			return m, tea.Batch(
 				func() tea.Msg {
-					response, cmdSuggestion, err := m.agent.SendMessage(
-						context.Background(), 
-						fmt.Sprintf("Command %s executed. Output: %s", msg.Command_to_execute.Command, output),
-					)
-					if err != nil {
-						return SystemMessage{Content: "Error: " + err.Error()}
-					}
-					if cmdSuggestion != nil {
-						return CommandSuggestionMsg{Command: cmdSuggestion.Command, Reason: cmdSuggestion.Reason}
-					}
-					return LLMResponseMsg{Content: response}
+					return m.AIChat(fmt.Sprintf("Command %s executed. Output: %s", msg.Command_to_execute.Command, output))
 				},
 				thinkingTick(),
 			)
 		} else if msg.Function_to_execute != nil {
 			m.PendingFunctionCall = msg.Function_to_execute
-			m.AddSystemMessage(fmt.Sprintf("Executing function: %s ...\n", msg.Function_to_execute.Name))
+			m.AddMessage(Message{
+				Kind:    KindCommand,
+				Content: fmt.Sprintf("Executing function: %s ...\n", msg.Function_to_execute.Name),
+				Payload: &FunctionPayload{Name: msg.Function_to_execute.Name, Args: msg.Function_to_execute.Args},
+			})
+			start := time.Now()
 			output, err := m.ExecuteFunctionCall(msg.Function_to_execute)
-			if err != nil {
-				m.AddSystemMessage(fmt.Sprintf("Error: %s", err))
-			} else {
-				m.AddSystemMessage(fmt.Sprintf("Output:\n%s", output))
-			}
+			m.AddMessage(functionResultMessage(msg.Function_to_execute, output, err, time.Since(start)))
 			m.StartThinking()
 			m.PendingFunctionCall = nil
 			return m, tea.Batch(
 					func() tea.Msg {
-						response, cmdSuggestion, err := m.agent.SendMessage(context.Background(), fmt.Sprintf("Function %s executed. Output: %s", msg.Function_to_execute.Name, output))
-						if err != nil {
-							return SystemMessage{Content: "Error: " + err.Error()}
-						}
-						if cmdSuggestion != nil {
-							return CommandSuggestionMsg{Command: cmdSuggestion.Command, Reason: cmdSuggestion.Reason}
-						}
-						return LLMResponseMsg{Content: response}
+						return m.AIChat(fmt.Sprintf("Function %s executed. Output: %s", msg.Function_to_execute.Name, output))
 					},
 				thinkingTick(),
 			)
@@ -1,11 +1,13 @@
 package ui
 
 import (
-	"menace-go/llmServer"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 	"github.com/charmbracelet/x/cellbuf"
 	zone "github.com/lrstanley/bubblezone"
 	"github.com/mattn/go-runewidth"
@@ -27,7 +29,6 @@ func (m Model) View() string {
 		dir = "unknown directory"
 	}
 	// Sidebar header and controls
-	mf := llmServer.ModelFactory{}
 	dirParts := strings.Split(dir, string(os.PathSeparator))
 	formattedDir := ""
 	for i, part := range dirParts {
@@ -39,30 +40,50 @@ func (m Model) View() string {
 		}
 	}
 
-	var InfoStyle = lipgloss.NewStyle().
-		Foreground(lipgloss.Color("#8be9fd")).
-		Bold(true).MarginBottom(1)
-	osShellInfo := InfoStyle.Render("💻 " + mf.DetectShell())
+	osShellInfo := InfoStyle.Render("💻 " + m.agent.Shell())
 	helpButton := zone.Mark("help", ButtonStyle.Render("help"))
 	configButton := zone.Mark("config", ButtonStyle.Render("config"))
 	// Use helpButton in your sidebar string
 
-	var SectionHeaderStyle = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(lipgloss.Color("#bd93f9"))
 	sidebar := HeaderStyle.Render("Menace CLI") +
 		"\n" + SectionHeaderStyle.MarginBottom(1).Render("Running on:") +
 		"\n  " + osShellInfo +
 		"\n" + SectionHeaderStyle.Render("Model:") +
 		"\n  " + m.agent.Model +
+		"\n" + SectionHeaderStyle.Render("Persona:") +
+		"\n  " + m.agent.Persona() +
 		"\n" + SectionHeaderStyle.Render("Working Directory:") +
-		"\n" + formattedDir +
-		"\n" + helpButton + "\n" + configButton
+		"\n" + formattedDir
+	if pinned := m.agent.PinnedFiles(); len(pinned) > 0 {
+		sidebar += "\n" + SectionHeaderStyle.Render("Pinned:")
+		for _, path := range pinned {
+			sidebar += "\n 📌 " + runewidth.Truncate(filepath.Base(path), 14, "…")
+		}
+		sidebar += "\n"
+	}
+	if len(m.Pulls) > 0 {
+		sidebar += "\n" + SectionHeaderStyle.Render("Pulling:")
+		for _, name := range m.pullNames() {
+			percent := ""
+			if progress := m.Pulls[name]; progress.Total > 0 {
+				percent = fmt.Sprintf(" %d%%", 100*progress.Completed/progress.Total)
+			}
+			sidebar += "\n ↓ " + runewidth.Truncate(name, 12, "…") + percent
+		}
+		sidebar += "\n"
+	}
+	sidebar += "\n" + helpButton + "\n" + configButton
 
+	if m.Help.Open {
+		return m.HelpView(termHeight, termWidth)
+	}
 	// If config is open, show config page
 	if m.IsConfigOpen {
 		return m.ConfigView(termHeight, termWidth)
 	}
+	if m.IsMemoryOpen {
+		return m.MemoryView(termHeight, termWidth)
+	}
 
 	sidebar = lipgloss.NewStyle().
 		Align(lipgloss.Left, lipgloss.Top).
@@ -71,84 +92,35 @@ func (m Model) View() string {
 		Render(sidebar)
 
 	// Render messages line by line with wrapping, applying scroll offset
-	var renderedLines []string
 	// chat content width: total width minus sidebar and margins
-	chatWidth := termWidth - 24
+	chatWidth := m.mainWidth(termWidth)
 	// account for ChatStyle padding (1 left, 1 right)
 	wrapWidth := chatWidth - 2
 	if wrapWidth < 1 {
 		wrapWidth = 1
 	}
-	for _, msg := range m.Messages {
-		var styleFunc func(...string) string
-		var prefix string
-		switch msg.Sender {
-		case "user":
-			styleFunc = UserStyle.Render
-			prefix = "> "
-		case "llm":
-			styleFunc = LLMStyle.Render
-			prefix = "🤖 "
-		default:
-			//system style
-			styleFunc = SystemStyle.Render
-			prefix = "👾 "
-			// Add dots to thinking message
-			if msg.Content == ThinkingState && m.IsThinking {
-				msg.Content = ThinkingState + strings.Repeat(".", m.ThinkingDots)
-			}
-		}
-		// measure prefix width and prepare indent for wrapped lines
-		prefixWidth := runewidth.StringWidth(prefix)
-		prefixIndent := strings.Repeat(" ", prefixWidth)
-		firstLine := true
-		for _, part := range strings.Split(msg.Content, "\n") {
-			// wrap part at content width minus prefix
-			lineWidth := wrapWidth - prefixWidth
-			if lineWidth < 1 {
-				lineWidth = 1
-			}
-			wrapped := cellbuf.Wrap(part, lineWidth, "")
-			for _, line := range strings.Split(wrapped, "\n") {
-				if firstLine {
-					renderedLines = append(renderedLines, styleFunc(prefix+line))
-					firstLine = false
-				} else {
-					renderedLines = append(renderedLines, styleFunc(prefixIndent+line))
-				}
-			}
-		}
-	}
+	renderedLines := m.renderChatLines(wrapWidth)
 	// Determine how many lines fit in chat box
 	visibleLines := termHeight - 7
 	if visibleLines < 0 {
 		visibleLines = 0
 	}
 	// Slice lines based on scroll (0 = bottom)
-	totalLines := len(renderedLines)
-	var linesToRender []string
-	if totalLines > visibleLines {
-		start := totalLines - visibleLines - m.Scroll
-		if start < 0 {
-			start = 0
-		}
-		end := totalLines - m.Scroll
-		if end > totalLines {
-			end = totalLines
-		}
-		linesToRender = renderedLines[start:end]
-	} else {
-		linesToRender = renderedLines
+	start, end := chatWindow(len(renderedLines), visibleLines, m.Scroll)
+	linesToRender := make([]string, 0, end-start)
+	for y := start; y < end; y++ {
+		linesToRender = append(linesToRender, m.highlightChatLine(y, renderedLines[y]))
 	}
 	chatBody := lipgloss.JoinVertical(lipgloss.Top, linesToRender...)
-	chatBox := ChatStyle.
-		Width(termWidth - 24).  // Adjust width to fit next to the sidebar
-		Height(termHeight - 5). // Leave space for input box
-		Render(chatBody)
+	// The chat zone maps mouse positions back to transcript lines for selection
+	chatBox := zone.Mark(chatZone, ChatStyle.
+		Width(chatWidth).     // Adjust width to fit next to the sidebar
+		Height(termHeight-5). // Leave space for input box
+		Render(chatBody))
 
 	// Render input area with block cursor and proper wrapping/indent
 	prefix := "> "
-	boxW := termWidth - 24
+	boxW := chatWidth
 	prefixW := runewidth.StringWidth(prefix)
 	// maxInputW := boxW - 2 - prefixW // no longer needed
 
@@ -181,17 +153,15 @@ func (m Model) View() string {
 
 		// Handle highlighting
 		if m.IsHighlighting {
+			startX, startY, endX, endY := m.inputSelection()
 			lineStr := ""
 			for j, r := range visible {
 				pos := windowStart + j
-				isSelected := (i > m.SelectionStartY || (i == m.SelectionStartY && pos >= m.SelectionStartX)) &&
-					(i < m.SelectionEndY || (i == m.SelectionEndY && pos <= m.SelectionEndX))
+				isSelected := (i > startY || (i == startY && pos >= startX)) &&
+					(i < endY || (i == endY && pos < endX))
 
 				if isSelected {
-					lineStr += lipgloss.NewStyle().
-						Background(lipgloss.Color("#8be9fd")). // Light blue background
-						Foreground(lipgloss.Color("#000000")). // Black text for contrast
-						Render(string(r))
+					lineStr += InputSelectionStyle.Render(string(r))
 				} else {
 					lineStr += string(r)
 				}
@@ -226,19 +196,174 @@ func (m Model) View() string {
 		rendered = append(rendered, curPfx+string(visible))
 	}
 	inputContent := strings.Join(rendered, "\n")
+	if m.CommandPopupOpen() {
+		inputContent = m.renderCommandPopup(maxInputW) + "\n" + inputContent
+	} else if m.QuestionOpen() {
+		inputContent = m.renderQuestion(maxInputW) + "\n" + inputContent
+	}
+	if len(m.MentionSuggestions) > 0 {
+		inputContent = MentionSuggestionStyle.Render(strings.Join(m.MentionSuggestions, "  ")) + "\n" + inputContent
+	}
+	if len(m.Attachments) > 0 {
+		inputContent = m.renderAttachmentChips() + "\n" + inputContent
+	}
+	if m.Search.Open {
+		inputContent = m.renderSearchBar(renderedLines) + "\n" + inputContent
+	}
+	if m.IsEditingMessage {
+		inputContent = CommandPopupStyle.Render("Editing an earlier message: "+m.keymap.ShortHelp(ActionSend)+" resends from there, "+m.keymap.ShortHelp(ActionCancel)+" cancels") + "\n" + inputContent
+	}
 	inputPrompt := InputStyle.
 		Border(lipgloss.RoundedBorder()).
 		Width(boxW).
 		Render(inputContent)
+	if m.Vim.Enabled {
+		inputPrompt = borderTitle(inputPrompt, VimModeStyle.Render(" "+m.vimStatus()+" "))
+	}
 
 	// Combine chat and input
 	mainArea := lipgloss.JoinVertical(lipgloss.Top, chatBox, inputPrompt)
 
 	// Layout: sidebar + main area
-	screen := lipgloss.JoinHorizontal(lipgloss.Top, sidebar, mainArea)
+	screen := mainArea
+	if !m.HideSidebar {
+		screen = lipgloss.JoinHorizontal(lipgloss.Top, sidebar, mainArea)
+	}
 
 	// Add horizontal margins; place UI flush to top so chat-box top border is visible
 	return zone.Scan(lipgloss.NewStyle().
 		Margin(0, 2). // top/bottom, left/right
 		Render(screen))
 }
+
+// chatLine is one wrapped line of the transcript
+type chatLine struct {
+	Rendered string
+	// Message is the index into Model.Messages the line belongs to
+	Message int
+	// Indent is the width of the sender prefix, which is never copied
+	Indent int
+	// SoftWrap is true when the line continues the previous one after word wrapping,
+	// WrappedAtSpace when the wrap replaced a space rather than splitting a long word
+	SoftWrap       bool
+	WrappedAtSpace bool
+}
+
+// renderChatLines renders the transcript to wrapped, styled lines, oldest first
+func (m Model) renderChatLines(wrapWidth int) []chatLine {
+	var renderedLines []chatLine
+	for i, msg := range m.Messages {
+		var styleFunc func(...string) string
+		var prefix string
+		switch msg.Kind {
+		case KindUser:
+			styleFunc = UserStyle.Render
+			prefix = "> "
+		case KindAgent, KindExplanation:
+			styleFunc = LLMStyle.Render
+			prefix = "🤖 "
+		case KindError:
+			styleFunc = ErrorStyle.Render
+			prefix = "👾 "
+		case KindThinking:
+			styleFunc = SystemStyle.Render
+			prefix = "👾 "
+			// Add dots to thinking message
+			if m.IsThinking {
+				msg.Content = ThinkingState + strings.Repeat(".", m.ThinkingDots)
+			}
+		default:
+			//system style
+			styleFunc = SystemStyle.Render
+			prefix = "👾 "
+		}
+		// measure prefix width and prepare indent for wrapped lines
+		prefixWidth := runewidth.StringWidth(prefix)
+		prefixIndent := strings.Repeat(" ", prefixWidth)
+
+		// Assistant prose is markdown, it brings its own colors
+		if msg.Kind == KindAgent {
+			for j, line := range renderAgentMarkdown(i, msg.Content, wrapWidth-prefixWidth) {
+				if j == 0 {
+					line = styleFunc(prefix) + line
+				} else {
+					line = prefixIndent + line
+				}
+				renderedLines = append(renderedLines, chatLine{Rendered: line, Message: i, Indent: prefixWidth})
+			}
+			continue
+		}
+
+		// Long outputs show a preview with a toggle line in the middle, or at the end when expanded
+		parts := strings.Split(msg.Content, "\n")
+		toggleAt := -1
+		if msg.Collapsible() {
+			parts, toggleAt = collapseParts(parts, msg.Expanded, m.keymap.toggleHint())
+		}
+
+		firstLine := true
+		for p, part := range parts {
+			if p == toggleAt {
+				renderedLines = append(renderedLines, chatLine{
+					Rendered: prefixIndent + zone.Mark(toggleZone(i), CollapseToggleStyle.Render(part)),
+					Message:  i,
+					Indent:   prefixWidth,
+				})
+				continue
+			}
+			// wrap part at content width minus prefix
+			lineWidth := wrapWidth - prefixWidth
+			if lineWidth < 1 {
+				lineWidth = 1
+			}
+			pieces := strings.Split(cellbuf.Wrap(part, lineWidth, ""), "\n")
+			for j, line := range pieces {
+				if firstLine {
+					line = styleFunc(prefix + line)
+					// Clicking a user message edits it
+					if msg.Kind == KindUser {
+						line = zone.Mark(messageZone(i), line)
+					}
+					firstLine = false
+				} else {
+					line = styleFunc(prefixIndent + line)
+				}
+				renderedLines = append(renderedLines, chatLine{
+					Rendered:       line,
+					Message:        i,
+					Indent:         prefixWidth,
+					SoftWrap:       j > 0,
+					WrappedAtSpace: j > 0 && runewidth.StringWidth(pieces[j-1]) < lineWidth,
+				})
+			}
+		}
+	}
+	return renderedLines
+}
+
+// chatWindow returns the range of lines visible in the chat box given the scroll offset (0 = bottom)
+func chatWindow(totalLines int, visibleLines int, scroll int) (start int, end int) {
+	if totalLines <= visibleLines {
+		return 0, totalLines
+	}
+	start = totalLines - visibleLines - scroll
+	if start < 0 {
+		start = 0
+	}
+	end = totalLines - scroll
+	if end > totalLines {
+		end = totalLines
+	}
+	return start, end
+}
+
+// borderTitle writes title into the top border of a rendered box, after its corner
+func borderTitle(box string, title string) string {
+	top, rest, _ := strings.Cut(box, "\n")
+	width := ansi.StringWidth(top)
+	titleWidth := ansi.StringWidth(title)
+	if titleWidth+4 > width {
+		return box
+	}
+	return ansi.Cut(top, 0, 2) + title + ansi.Cut(top, 2+titleWidth, width) + "\n" + rest
+}
@@ -0,0 +1,810 @@
+package ui
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// VimMode is the editing mode of the input while Vim keybindings are on
+type VimMode int
+
+const (
+	VimInsert VimMode = iota
+	VimNormal
+	VimVisual
+	VimVisualLine
+)
+
+// String is the name shown in the input border
+func (mode VimMode) String() string {
+	switch mode {
+	case VimNormal:
+		return "NORMAL"
+	case VimVisual:
+		return "VISUAL"
+	case VimVisualLine:
+		return "VISUAL LINE"
+	}
+	return "INSERT"
+}
+
+// vimRegister is yanked or deleted text, Linewise text is pasted as whole lines
+type vimRegister struct {
+	Text     string
+	Linewise bool
+}
+
+// VimState is the modal editing state of the input, see HandleVimKey
+type VimState struct {
+	Enabled bool
+	Mode    VimMode
+	// count typed before a command, "" for none
+	count string
+	// operator waiting for a motion: 'd', 'c', 'y' or 0, with the count typed before it
+	operator      rune
+	operatorCount int
+	// pending is a key waiting for a character: 'f', 'F', 't', 'T', 'r', 'g' or '"'
+	pending rune
+	// register chosen with "x for the next command, 0 for the unnamed register
+	register  rune
+	registers map[rune]vimRegister
+	// Where visual mode started
+	anchorX int
+	anchorY int
+}
+
+// SetVimMode turns the Vim keybindings on or off, the input starts in insert mode either way
+func (m *Model) SetVimMode(enabled bool) {
+	registers := m.Vim.registers
+	m.Vim = VimState{Enabled: enabled, registers: registers}
+	m.ClearInputSelection()
+}
+
+// vimStatus is the mode and any half-typed command, for the input border
+func (m *Model) vimStatus() string {
+	status := m.Vim.Mode.String()
+	pending := ""
+	if m.Vim.register != 0 {
+		pending += "\"" + string(m.Vim.register)
+	}
+	if m.Vim.operatorCount > 1 {
+		pending += strconv.Itoa(m.Vim.operatorCount)
+	}
+	if m.Vim.operator != 0 {
+		pending += string(m.Vim.operator)
+	}
+	pending += m.Vim.count
+	if m.Vim.pending != 0 {
+		pending += string(m.Vim.pending)
+	}
+	if pending != "" {
+		status += " " + pending
+	}
+	return status
+}
+
+// resetVimCommand drops a half-typed command
+func (m *Model) resetVimCommand() {
+	m.Vim.count = ""
+	m.Vim.operator = 0
+	m.Vim.operatorCount = 0
+	m.Vim.pending = 0
+	m.Vim.register = 0
+}
+
+// HandleVimKey handles a key in Vim mode, returns false for keys that should get their usual meaning.
+//
+// Insert mode only takes Esc. Enter, Ctrl+C and the other control keys keep working in every mode.
+func (m *Model) HandleVimKey(msg tea.KeyMsg) bool {
+	if m.Vim.Mode == VimInsert {
+		if msg.Type != tea.KeyEsc {
+			return false
+		}
+		m.Vim.Mode = VimNormal
+		m.ClearInputSelection()
+		if m.CursorX > 0 {
+			m.CursorX--
+		}
+		return true
+	}
+
+	before := m.snapshot()
+	key := vimKey(msg)
+	switch {
+	case msg.Type == tea.KeyEsc:
+		// Esc with nothing to cancel is left to the app, e.g. to cancel editing a message
+		if m.Vim.Mode == VimNormal && m.Vim.operator == 0 && m.Vim.pending == 0 && m.Vim.count == "" && m.Vim.register == 0 {
+			return false
+		}
+		m.resetVimCommand()
+		m.leaveVisual()
+	case msg.Type == tea.KeyCtrlR:
+		m.resetVimCommand()
+		m.Redo()
+		return true
+	case key == 'u' && m.Vim.pending == 0 && m.Vim.Mode == VimNormal:
+		for i := atLeastOne(m.takeCount()); i > 0; i-- {
+			m.Undo()
+		}
+		m.resetVimCommand()
+		m.clampVimCursor()
+		return true
+	case key == 0:
+		return false
+	default:
+		m.runVimKey(key)
+	}
+	m.RecordEdit(before, false)
+	m.clampVimCursor()
+	return true
+}
+
+// vimKey maps a keypress to the Vim command character, 0 for keys Vim mode doesn't use
+func vimKey(msg tea.KeyMsg) rune {
+	switch msg.Type {
+	case tea.KeyRunes:
+		if len(msg.Runes) == 1 && !msg.Alt && !msg.Paste {
+			return msg.Runes[0]
+		}
+	case tea.KeySpace:
+		return 'l'
+	case tea.KeyLeft, tea.KeyBackspace:
+		return 'h'
+	case tea.KeyRight:
+		return 'l'
+	case tea.KeyUp:
+		return 'k'
+	case tea.KeyDown:
+		return 'j'
+	case tea.KeyHome:
+		return '0'
+	case tea.KeyEnd:
+		return '$'
+	case tea.KeyDelete:
+		return 'x'
+	}
+	return 0
+}
+
+// takeCount returns the count typed before the command, 0 if none, and clears it
+func (m *Model) takeCount() int {
+	count, _ := strconv.Atoi(m.Vim.count)
+	m.Vim.count = ""
+	if m.Vim.operatorCount > 0 {
+		if count == 0 {
+			count = 1
+		}
+		count *= m.Vim.operatorCount
+	}
+	return count
+}
+
+// atLeastOne turns a missing count into 1
+func atLeastOne(count int) int {
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+// runVimKey runs one normal or visual mode key
+func (m *Model) runVimKey(key rune) {
+	v := &m.Vim
+	if v.pending != 0 {
+		pending := v.pending
+		v.pending = 0
+		switch pending {
+		case '"':
+			v.register = key
+		case 'r':
+			m.vimReplace(key, atLeastOne(m.takeCount()))
+			m.resetVimCommand()
+		case 'g':
+			if key == 'g' {
+				m.vimMove('g', 0)
+			} else {
+				m.resetVimCommand()
+			}
+		case 'i', 'a':
+			m.vimTextObject(pending == 'a', key)
+		default:
+			m.vimMove(pending, key)
+		}
+		return
+	}
+
+	if unicode.IsDigit(key) && (key != '0' || v.count != "") {
+		v.count += string(key)
+		return
+	}
+
+	// After an operator or in visual mode, i and a start a text object such as iw
+	if (key == 'i' || key == 'a') && (v.operator != 0 || v.Mode != VimNormal) {
+		v.pending = key
+		return
+	}
+
+	switch key {
+	case '"', 'f', 'F', 't', 'T', 'r', 'g':
+		v.pending = key
+		return
+	case 'h', 'j', 'k', 'l', 'w', 'W', 'b', 'B', 'e', 'E', '0', '^', '$', 'G':
+		m.vimMove(key, 0)
+		return
+	}
+
+	if m.Vim.Mode != VimNormal {
+		m.vimVisualCommand(key)
+		return
+	}
+
+	// Anything but a motion or the same operator again cancels a pending operator
+	if v.operator != 0 && key != v.operator {
+		m.resetVimCommand()
+		return
+	}
+
+	switch key {
+	case 'd', 'c', 'y':
+		if v.operator == key {
+			// dd, cc and yy work on count lines
+			count := atLeastOne(m.takeCount())
+			m.vimOperate(key, 0, m.CursorY, 0, m.CursorY+count-1, false, true)
+			m.resetVimCommand()
+			return
+		}
+		v.operator = key
+		v.operatorCount, _ = strconv.Atoi(v.count)
+		v.count = ""
+	case 'x', 's':
+		// x is dl and s is cl
+		v.operator = 'd'
+		if key == 's' {
+			v.operator = 'c'
+		}
+		m.vimMove('l', 0)
+	case 'X':
+		v.operator = 'd'
+		m.vimMove('h', 0)
+	case 'D', 'C':
+		v.operator = unicode.ToLower(key)
+		m.vimMove('$', 0)
+	case 'Y':
+		v.operator = 'y'
+		m.runVimKey('y')
+	case 'S':
+		v.operator = 'c'
+		m.runVimKey('c')
+	case 'p', 'P':
+		m.vimPaste(key == 'p', atLeastOne(m.takeCount()))
+		m.resetVimCommand()
+	case 'i', 'a', 'I', 'A', 'o', 'O':
+		m.vimInsert(key)
+		m.resetVimCommand()
+	case 'v', 'V':
+		v.anchorX, v.anchorY = m.CursorX, m.CursorY
+		v.Mode = VimVisual
+		if key == 'V' {
+			v.Mode = VimVisualLine
+		}
+		m.resetVimCommand()
+		m.updateVisualSelection()
+	case 'J':
+		m.vimJoin(atLeastOne(m.takeCount()))
+		m.resetVimCommand()
+	default:
+		m.resetVimCommand()
+	}
+}
+
+// vimVisualCommand runs a key that acts on the visual selection
+func (m *Model) vimVisualCommand(key rune) {
+	v := &m.Vim
+	linewise := v.Mode == VimVisualLine
+	switch key {
+	case 'd', 'x', 'y':
+		operator := 'd'
+		if key == 'y' {
+			operator = 'y'
+		}
+		m.vimOperate(operator, v.anchorX, v.anchorY, m.CursorX, m.CursorY, true, linewise)
+		m.leaveVisual()
+	case 'c', 's':
+		m.vimOperate('c', v.anchorX, v.anchorY, m.CursorX, m.CursorY, true, linewise)
+	case 'D', 'X', 'Y':
+		// The uppercase operators always take whole lines
+		operator := 'd'
+		if key == 'Y' {
+			operator = 'y'
+		}
+		m.vimOperate(operator, 0, v.anchorY, 0, m.CursorY, false, true)
+		m.leaveVisual()
+	case 'p', 'P':
+		// Replace the selection with the register, which keeps its text
+		register := m.vimRegister()
+		v.register = 0
+		startY := min(v.anchorY, m.CursorY)
+		m.vimOperate('d', v.anchorX, v.anchorY, m.CursorX, m.CursorY, true, linewise)
+		m.leaveVisual()
+		m.Vim.registers['"'] = register
+		// Lines deleted from the end of the input go back below the new last line
+		m.vimPaste(linewise && startY > m.CursorY, 1)
+	case 'o':
+		v.anchorX, m.CursorX = m.CursorX, v.anchorX
+		v.anchorY, m.CursorY = m.CursorY, v.anchorY
+		m.updateVisualSelection()
+	case 'v', 'V':
+		mode := VimVisual
+		if key == 'V' {
+			mode = VimVisualLine
+		}
+		if v.Mode == mode {
+			m.leaveVisual()
+		} else {
+			v.Mode = mode
+			m.updateVisualSelection()
+		}
+	}
+	m.resetVimCommand()
+}
+
+// leaveVisual goes back to normal mode from visual mode
+func (m *Model) leaveVisual() {
+	if m.Vim.Mode == VimVisual || m.Vim.Mode == VimVisualLine {
+		m.Vim.Mode = VimNormal
+		m.ClearInputSelection()
+	}
+}
+
+// updateVisualSelection highlights from the visual anchor to the cursor, both included
+func (m *Model) updateVisualSelection() {
+	lines := strings.Split(m.Input, "\n")
+	startX, startY, endX, endY := m.Vim.anchorX, m.Vim.anchorY, m.CursorX, m.CursorY
+	if startY > endY || (startY == endY && startX > endX) {
+		startX, startY, endX, endY = endX, endY, startX, startY
+	}
+	if m.Vim.Mode == VimVisualLine {
+		startX, endX = 0, len([]rune(lines[endY]))
+	} else if endX < len([]rune(lines[endY])) {
+		endX++
+	}
+	m.IsHighlighting = true
+	m.SelectionStartX, m.SelectionStartY = startX, startY
+	m.SelectionEndX, m.SelectionEndY = endX, endY
+}
+
+// currentLine is the line the cursor is on
+func (m *Model) currentLine() string {
+	return strings.Split(m.Input, "\n")[m.CursorY]
+}
+
+// clampVimCursor keeps the cursor on a character outside insert mode, as Vim does
+func (m *Model) clampVimCursor() {
+	if m.Vim.Mode == VimInsert {
+		return
+	}
+	lines := strings.Split(m.Input, "\n")
+	if m.CursorY >= len(lines) {
+		m.CursorY = len(lines) - 1
+	}
+	if n := len([]rune(lines[m.CursorY])); m.CursorX >= n {
+		m.CursorX = n - 1
+	}
+	if m.CursorX < 0 {
+		m.CursorX = 0
+	}
+}
+
+// vimMove applies a motion: it moves the cursor, extends the visual selection, or completes
+// a pending operator. arg is the character for f, F, t and T.
+func (m *Model) vimMove(motion rune, arg rune) {
+	count := m.takeCount()
+	x, y, inclusive, linewise, ok := m.vimMotion(motion, arg, count)
+	if !ok {
+		m.resetVimCommand()
+		return
+	}
+	if m.Vim.operator != 0 {
+		// cw changes to the end of the word, dw stops at the end of the line
+		if motion == 'w' || motion == 'W' {
+			if m.Vim.operator == 'c' {
+				if r := []rune(m.currentLine()); m.CursorX < len(r) && !unicode.IsSpace(r[m.CursorX]) {
+					end := 'e'
+					if motion == 'W' {
+						end = 'E'
+					}
+					x, y, inclusive, _, _ = m.vimMotion(end, 0, count)
+				}
+			}
+			if y > m.CursorY {
+				x, y = len([]rune(m.currentLine())), m.CursorY
+			}
+		}
+		m.vimOperate(m.Vim.operator, m.CursorX, m.CursorY, x, y, inclusive, linewise)
+		m.resetVimCommand()
+		return
+	}
+	m.CursorX, m.CursorY = x, y
+	m.resetVimCommand()
+	if m.Vim.Mode == VimVisual || m.Vim.Mode == VimVisualLine {
+		m.updateVisualSelection()
+	}
+}
+
+// vimTextObject applies the pending operator to, or visually selects, the word under the cursor.
+//
+// iw is the word or run of spaces under the cursor, aw also takes the spaces after it (or before it at the end of a line).
+func (m *Model) vimTextObject(around bool, object rune) {
+	line := []rune(m.currentLine())
+	if (object != 'w' && object != 'W') || len(line) == 0 {
+		m.resetVimCommand()
+		return
+	}
+	big := object == 'W'
+	x := min(m.CursorX, len(line)-1)
+	start, end := x, x+1
+	c := vimClass(line[x], big)
+	for start > 0 && vimClass(line[start-1], big) == c {
+		start--
+	}
+	for end < len(line) && vimClass(line[end], big) == c {
+		end++
+	}
+	if around && c != 0 {
+		trailing := end
+		for trailing < len(line) && vimClass(line[trailing], big) == 0 {
+			trailing++
+		}
+		if trailing > end {
+			end = trailing
+		} else {
+			for start > 0 && vimClass(line[start-1], big) == 0 {
+				start--
+			}
+		}
+	}
+
+	if m.Vim.operator != 0 {
+		m.vimOperate(m.Vim.operator, start, m.CursorY, end-1, m.CursorY, true, false)
+		m.resetVimCommand()
+		return
+	}
+	m.Vim.anchorX, m.Vim.anchorY = start, m.CursorY
+	m.CursorX = end - 1
+	m.resetVimCommand()
+	m.updateVisualSelection()
+}
+
+// vimClass groups characters for word motions: 0 for space, 1 for words, 2 for punctuation.
+//
+// With big, any run of non-space characters is a word, as for W, B and E.
+func vimClass(r rune, big bool) int {
+	if unicode.IsSpace(r) {
+		return 0
+	}
+	if big || isWordRune(r) {
+		return 1
+	}
+	return 2
+}
+
+// inputPosition converts a rune offset into the whole input back to a cursor position
+func inputPosition(lines []string, offset int) (int, int) {
+	for y, line := range lines {
+		n := len([]rune(line))
+		if offset <= n || y == len(lines)-1 {
+			return offset, y
+		}
+		offset -= n + 1
+	}
+	return 0, 0
+}
+
+// firstNonBlank is the column of the first non-space character of line
+func firstNonBlank(line string) int {
+	for x, r := range []rune(line) {
+		if !unicode.IsSpace(r) {
+			return x
+		}
+	}
+	return 0
+}
+
+// vimMotion returns where motion moves the cursor, count times if count > 0.
+//
+// Inclusive motions take the target character into an operator's range, linewise ones whole lines.
+func (m *Model) vimMotion(motion rune, arg rune, count int) (x, y int, inclusive, linewise, ok bool) {
+	lines := strings.Split(m.Input, "\n")
+	n := atLeastOne(count)
+	x, y = m.CursorX, m.CursorY
+	line := []rune(lines[y])
+
+	switch motion {
+	case 'h':
+		x = max(x-n, 0)
+	case 'l':
+		x = min(x+n, len(line))
+	case 'j', 'k':
+		if motion == 'j' {
+			y = min(y+n, len(lines)-1)
+		} else {
+			y = max(y-n, 0)
+		}
+		x = min(x, len([]rune(lines[y])))
+		linewise = true
+	case '0':
+		x = 0
+	case '^':
+		x = firstNonBlank(lines[y])
+	case '$':
+		y = min(y+n-1, len(lines)-1)
+		x = max(len([]rune(lines[y]))-1, 0)
+		inclusive = true
+	case 'g', 'G':
+		y = 0
+		if motion == 'G' {
+			y = len(lines) - 1
+		}
+		if count > 0 {
+			y = min(count-1, len(lines)-1)
+		}
+		x = firstNonBlank(lines[y])
+		linewise = true
+	case 'w', 'W', 'b', 'B', 'e', 'E':
+		big := unicode.IsUpper(motion)
+		runes := []rune(m.Input)
+		pos := inputOffset(lines, x, y)
+		for i := 0; i < n; i++ {
+			switch unicode.ToLower(motion) {
+			case 'w':
+				if pos < len(runes) {
+					if c := vimClass(runes[pos], big); c != 0 {
+						for pos < len(runes) && vimClass(runes[pos], big) == c {
+							pos++
+						}
+					}
+				}
+				for pos < len(runes) && vimClass(runes[pos], big) == 0 {
+					pos++
+				}
+			case 'e':
+				pos++
+				for pos < len(runes) && vimClass(runes[pos], big) == 0 {
+					pos++
+				}
+				if pos >= len(runes) {
+					pos = max(len(runes)-1, 0)
+					break
+				}
+				c := vimClass(runes[pos], big)
+				for pos+1 < len(runes) && vimClass(runes[pos+1], big) == c {
+					pos++
+				}
+			case 'b':
+				pos--
+				for pos > 0 && vimClass(runes[pos], big) == 0 {
+					pos--
+				}
+				if pos <= 0 {
+					pos = 0
+					break
+				}
+				c := vimClass(runes[pos], big)
+				for pos > 0 && vimClass(runes[pos-1], big) == c {
+					pos--
+				}
+			}
+		}
+		x, y = inputPosition(lines, pos)
+		inclusive = unicode.ToLower(motion) == 'e'
+	case 'f', 'F', 't', 'T':
+		found := x
+		for i := 0; i < n; i++ {
+			next := -1
+			if motion == 'f' || motion == 't' {
+				for j := found + 1; j < len(line); j++ {
+					if line[j] == arg {
+						next = j
+						break
+					}
+				}
+			} else {
+				for j := found - 1; j >= 0; j-- {
+					if line[j] == arg {
+						next = j
+						break
+					}
+				}
+			}
+			if next < 0 {
+				return 0, 0, false, false, false
+			}
+			found = next
+		}
+		x = found
+		switch motion {
+		case 't':
+			x--
+		case 'T':
+			x++
+		}
+		inclusive = motion == 'f' || motion == 't'
+	default:
+		return 0, 0, false, false, false
+	}
+	return x, y, inclusive, linewise, true
+}
+
+// vimOperate applies operator d, c or y to the text between two positions
+func (m *Model) vimOperate(operator rune, x1, y1, x2, y2 int, inclusive, linewise bool) {
+	if y1 > y2 || (y1 == y2 && x1 > x2) {
+		x1, y1, x2, y2 = x2, y2, x1, y1
+	}
+	lines := strings.Split(m.Input, "\n")
+	y2 = min(y2, len(lines)-1)
+
+	if linewise {
+		m.vimStore(strings.Join(lines[y1:y2+1], "\n")+"\n", true)
+		switch operator {
+		case 'y':
+			m.CursorY = y1
+		case 'd':
+			lines = append(lines[:y1], lines[y2+1:]...)
+			if len(lines) == 0 {
+				lines = []string{""}
+			}
+			m.Input = strings.Join(lines, "\n")
+			m.CursorY = min(y1, len(lines)-1)
+			m.CursorX = firstNonBlank(lines[m.CursorY])
+		case 'c':
+			lines = append(append(lines[:y1:y1], ""), lines[y2+1:]...)
+			m.Input = strings.Join(lines, "\n")
+			m.CursorX, m.CursorY = 0, y1
+			m.Vim.Mode = VimInsert
+			m.ClearInputSelection()
+		}
+		return
+	}
+
+	if inclusive {
+		x2 = min(x2+1, len([]rune(lines[y2])))
+	}
+	runes := []rune(m.Input)
+	start := inputOffset(lines, x1, y1)
+	end := min(inputOffset(lines, x2, y2), len(runes))
+	if start < end {
+		m.vimStore(string(runes[start:end]), false)
+	}
+	switch operator {
+	case 'y':
+		m.CursorX, m.CursorY = x1, y1
+	case 'd':
+		m.deleteRange(x1, y1, x2, y2)
+	case 'c':
+		m.deleteRange(x1, y1, x2, y2)
+		m.Vim.Mode = VimInsert
+		m.ClearInputSelection()
+	}
+}
+
+// vimStore puts yanked or deleted text in the chosen register and the unnamed one.
+//
+// "+ and "* are the system clipboard, "A to "Z append to "a to "z.
+func (m *Model) vimStore(text string, linewise bool) {
+	if m.Vim.registers == nil {
+		m.Vim.registers = map[rune]vimRegister{}
+	}
+	register := vimRegister{Text: text, Linewise: linewise}
+	switch name := m.Vim.register; {
+	case name == '+' || name == '*':
+		m.CopyToClipboard(text)
+	case name >= 'a' && name <= 'z':
+		m.Vim.registers[name] = register
+	case name >= 'A' && name <= 'Z':
+		lower := unicode.ToLower(name)
+		register.Text = m.Vim.registers[lower].Text + text
+		m.Vim.registers[lower] = register
+	}
+	m.Vim.registers['"'] = register
+}
+
+// vimRegister returns the chosen register, reading the system clipboard for "+ and "*
+func (m *Model) vimRegister() vimRegister {
+	if m.Vim.registers == nil {
+		m.Vim.registers = map[rune]vimRegister{}
+	}
+	switch name := m.Vim.register; {
+	case name == '+' || name == '*':
+		text := strings.ReplaceAll(m.GetClipboardContent(), "\r\n", "\n")
+		return vimRegister{Text: text, Linewise: strings.HasSuffix(text, "\n")}
+	case name != 0:
+		return m.Vim.registers[unicode.ToLower(name)]
+	}
+	return m.Vim.registers['"']
+}
+
+// vimPaste puts the register after or before the cursor count times, whole lines go below or above it
+func (m *Model) vimPaste(after bool, count int) {
+	register := m.vimRegister()
+	if register.Text == "" {
+		return
+	}
+	lines := strings.Split(m.Input, "\n")
+	if register.Linewise {
+		pasted := strings.Split(strings.TrimSuffix(strings.Repeat(register.Text, count), "\n"), "\n")
+		at := m.CursorY
+		if after {
+			at++
+		}
+		lines = append(lines[:at], append(pasted, lines[at:]...)...)
+		m.Input = strings.Join(lines, "\n")
+		m.CursorY = at
+		m.CursorX = firstNonBlank(lines[at])
+		return
+	}
+
+	x := m.CursorX
+	if after && len([]rune(lines[m.CursorY])) > 0 {
+		x++
+	}
+	text := []rune(strings.Repeat(register.Text, count))
+	runes := []rune(m.Input)
+	offset := inputOffset(lines, x, m.CursorY)
+	m.Input = string(runes[:offset]) + string(text) + string(runes[offset:])
+	m.CursorX, m.CursorY = inputPosition(strings.Split(m.Input, "\n"), offset+len(text)-1)
+}
+
+// vimInsert enters insert mode the way i, a, I, A, o and O do
+func (m *Model) vimInsert(key rune) {
+	line := m.currentLine()
+	m.Vim.Mode = VimInsert
+	switch key {
+	case 'a':
+		m.CursorX = min(m.CursorX+1, len([]rune(line)))
+	case 'I':
+		m.CursorX = firstNonBlank(line)
+	case 'A':
+		m.CursorX = len([]rune(line))
+	case 'o':
+		m.CursorX = len([]rune(line))
+		m.InsertNewLine()
+	case 'O':
+		m.CursorX = 0
+		m.InsertNewLine()
+		m.CursorY--
+	}
+}
+
+// vimReplace replaces count characters under and after the cursor with r
+func (m *Model) vimReplace(r rune, count int) {
+	lines := strings.Split(m.Input, "\n")
+	line := []rune(lines[m.CursorY])
+	if m.CursorX+count > len(line) {
+		return
+	}
+	for i := 0; i < count; i++ {
+		line[m.CursorX+i] = r
+	}
+	lines[m.CursorY] = string(line)
+	m.Input = strings.Join(lines, "\n")
+	m.CursorX += count - 1
+}
+
+// vimJoin joins count lines starting at the cursor's, separated by a space
+func (m *Model) vimJoin(count int) {
+	lines := strings.Split(m.Input, "\n")
+	for i := 0; i < max(count-1, 1) && m.CursorY+1 < len(lines); i++ {
+		left := strings.TrimRight(lines[m.CursorY], " \t")
+		right := strings.TrimLeft(lines[m.CursorY+1], " \t")
+		m.CursorX = len([]rune(left))
+		if left != "" && right != "" {
+			left += " "
+		}
+		lines[m.CursorY] = left + right
+		lines = append(lines[:m.CursorY+1], lines[m.CursorY+2:]...)
+	}
+	m.Input = strings.Join(lines, "\n")
+}